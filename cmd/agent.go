@@ -0,0 +1,847 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"time"
+
+	"kgent/cmd/ai"
+	"kgent/cmd/backend"
+	"kgent/cmd/config"
+	"kgent/cmd/parser"
+	promptTpl "kgent/cmd/prompt"
+	"kgent/cmd/session"
+	"kgent/cmd/tools"
+	"kgent/cmd/utils"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// agent drives the reasoning loop shared by the chat and check commands
+type agent struct {
+	registry  *tools.Registry
+	debugMode bool
+	maxLoops  int
+
+	// toolCalling enables native OpenAI tool calling instead of the ReAct text format.
+	// It is switched off for the rest of the session if the model rejects tool definitions.
+	toolCalling bool
+
+	// stream renders the model output incrementally as it is generated
+	stream bool
+
+	// contextBudget is the estimated number of tokens the history may use before older
+	// messages are summarized; zero disables the limit
+	contextBudget int
+
+	// session is persisted after every turn so the conversation can be resumed
+	session *session.Session
+
+	// turn is the user input currently being processed
+	turn *session.Turn
+
+	// namespace is added to user inputs that do not mention a namespace
+	namespace string
+	// kubeContext is the kubeconfig context shown in the prompt
+	kubeContext string
+
+	// quiet suppresses all progress output, as in one-shot mode where the caller prints the answer
+	quiet bool
+
+	// plan makes the model propose all tool calls up front for the user to review before they run
+	plan bool
+
+	// input reads the user input of the interactive session
+	input *lineReader
+
+	// maxTokensBudget stops the session once its calls used that many tokens; zero disables it
+	maxTokensBudget int
+
+	// turnUsageStart is the total usage when the current turn started
+	turnUsageStart ai.Usage
+}
+
+// keepRecentMessages is the number of latest messages that are never compacted
+const keepRecentMessages = 2
+
+// kubectlTimeout limits the kubectl calls that read the kubeconfig
+const kubectlTimeout = 5 * time.Second
+
+// maxRecalledOutput limits how much of a tool output is kept in the history of past turns
+const maxRecalledOutput = 500
+
+// runAgent starts an interactive session of the given agent command, resuming a stored
+// session if the --resume flag is set
+func runAgent(cmd *cobra.Command, command string) {
+	setupAgent()
+
+	namespace, _ := cmd.Flags().GetString("namespace")
+	if namespace == "" {
+		namespace = config.Active.Namespace
+	}
+
+	resumeID, _ := cmd.Flags().GetString("resume")
+	if resumeID == "" {
+		s := session.New(command, namespace, ai.ModelName)
+		s.Context = config.Active.KubeContext
+		startSession(cmd, s)
+		return
+	}
+
+	s, err := session.Load(resumeID)
+	if err != nil {
+		utils.PrintRed("Error: %v", err)
+		return
+	}
+	if s.Command != command {
+		utils.PrintRed("Error: session %s was started with 'kgent %s', resume it with 'kgent %s --resume %s'",
+			s.ID, s.Command, s.Command, s.ID)
+		return
+	}
+	startSession(cmd, s)
+}
+
+// startSession answers a one-shot query, or runs the interactive loop, on top of the history stored in s
+func startSession(cmd *cobra.Command, s *session.Session) {
+	query, err := oneShotQuery(cmd)
+	if err != nil {
+		utils.PrintRed("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	oneShot := query != ""
+
+	debugMode, _ := cmd.Flags().GetBool("debug")
+	registry, err := newRegistry(s.Command, debugMode)
+	if err != nil {
+		utils.PrintRed("Error: %v", err)
+		return
+	}
+
+	// A namespace flag overrides the namespace of a resumed session
+	if namespace, _ := cmd.Flags().GetString("namespace"); namespace != "" {
+		s.Namespace = namespace
+	}
+	if s.Namespace != "" && !oneShot {
+		fmt.Printf("Using namespace: %s\n", s.Namespace)
+	}
+
+	// Likewise a context flag overrides the context of a resumed session, which otherwise
+	// keeps working on the cluster it was started on
+	if cmd.Flags().Changed("context") || s.Context == "" {
+		s.Context = config.Active.KubeContext
+	}
+	config.Active.KubeContext = s.Context
+
+	if len(s.Messages) > 0 {
+		ai.MessageStore = s.Messages
+		if !oneShot {
+			fmt.Printf("Resumed session %s with %d previous requests\n", s.ID, len(s.Turns))
+		}
+	} else {
+		ai.MessageStore.Clear()
+		if !oneShot {
+			fmt.Printf("Session: %s\n", s.ID)
+		}
+	}
+
+	// The system prompt of a resumed session is rebuilt, so it lists the current tools
+	ai.MessageStore.SetSystem(systemPrompt(registry))
+
+	a := newAgent(cmd, registry)
+	a.session = s
+	a.namespace = s.Namespace
+	if a.plan && s.Command != "chat" {
+		utils.PrintRed("Error: --plan is only available for chat sessions")
+		return
+	}
+
+	if oneShot {
+		output, _ := cmd.Flags().GetString("output")
+		os.Exit(a.runOnce(query, output))
+	}
+	a.runChatLoop(cmd)
+}
+
+// systemPrompt returns the system prompt of a conversation with the tools of registry
+func systemPrompt(registry *tools.Registry) string {
+	return promptTpl.SystemPrompt + fmt.Sprintf(promptTpl.SystemToolsTemplate, strings.Join(registry.Names(), ", "))
+}
+
+// newRegistry builds the toolset of the given agent command
+func newRegistry(command string, debugMode bool) (*tools.Registry, error) {
+	switch command {
+	case "chat":
+		return newChatRegistry(debugMode), nil
+	case "check":
+		return newCheckRegistry(), nil
+	default:
+		return nil, fmt.Errorf("unknown agent command %q", command)
+	}
+}
+
+// setupAgent configures the model and checks that the Kgent API is up, or that the kubeconfig
+// can be loaded in direct mode, and exits with a hint to run kgent doctor if something is missing
+func setupAgent() {
+	if err := ai.Setup(config.Active.Profile); err != nil {
+		utils.PrintRed("Error: %v", err)
+		utils.PrintYellow("Run 'kgent doctor' to check the configuration.")
+		os.Exit(1)
+	}
+	if config.Active.Backend == config.BackendDirect {
+		if _, err := backend.ResourcesFromConfig(); err != nil {
+			utils.PrintRed("Error: %v", err)
+			utils.PrintYellow("Run 'kgent doctor' to check the configuration.")
+			os.Exit(1)
+		}
+		return
+	}
+	client, err := backend.FromConfig()
+	if err != nil {
+		utils.PrintRed("Error: %v", err)
+		utils.PrintYellow("Run 'kgent doctor' to check the configuration.")
+		os.Exit(1)
+	}
+	if err := client.Health(context.Background()); err != nil {
+		utils.PrintRed("Error: health check of %s failed: %v", client.HealthURL(), err)
+		hint := backendAuthHint(err)
+		if hint == "" {
+			hint = "Run 'kgent doctor' to check the configuration."
+		}
+		utils.PrintYellow("%s", hint)
+		os.Exit(1)
+	}
+}
+
+// backendAuthHint explains how to fix a request that the Kgent API rejected for its
+// credentials, or returns an empty string for other errors
+func backendAuthHint(err error) string {
+	switch {
+	case errors.Is(err, backend.ErrUnauthorized):
+		return "Set the credentials of the Kgent API in backend_auth of the profile or with KGENT_API_TOKEN, see 'Authenticating to the Kgent API' in the README."
+	case errors.Is(err, backend.ErrForbidden):
+		return "The credentials of the Kgent API are not allowed to do this, ask the administrator of the Kgent API for access."
+	}
+	return ""
+}
+
+// newAgent creates an agent from the flags shared by the chat and check commands
+func newAgent(cmd *cobra.Command, registry *tools.Registry) *agent {
+	debugMode, _ := cmd.Flags().GetBool("debug")
+	maxLoops, _ := cmd.Flags().GetInt("max-loops")
+	if !cmd.Flags().Changed("max-loops") {
+		maxLoops = config.Active.MaxLoops
+	}
+	toolCalling, _ := cmd.Flags().GetBool("tool-calling")
+	stream, _ := cmd.Flags().GetBool("stream")
+	contextBudget, _ := cmd.Flags().GetInt("context-budget")
+	// Only chat and sessions resume accept --plan
+	plan, _ := cmd.Flags().GetBool("plan")
+	maxTokensBudget, _ := cmd.Flags().GetInt("max-tokens-budget")
+
+	if err := ai.LoadPrices(ai.PricesFile()); err != nil {
+		utils.PrintYellow("Warning: %v", err)
+	}
+
+	a := &agent{
+		registry:        registry,
+		debugMode:       debugMode,
+		maxLoops:        maxLoops,
+		toolCalling:     toolCalling,
+		stream:          stream,
+		contextBudget:   contextBudget,
+		plan:            plan,
+		maxTokensBudget: maxTokensBudget,
+	}
+
+	// Let the user know why a request takes longer while the model API is retried
+	ai.OnRetry = func(err error, attempt int, delay time.Duration) {
+		if !a.quiet {
+			utils.PrintYellow("%v, retrying in %s (%d/%d)", err, delay.Round(100*time.Millisecond), attempt, ai.MaxRetries)
+		}
+	}
+	ai.OnFallback = func(err error, model string) {
+		if !a.quiet {
+			utils.PrintYellow("%v, falling back to %s", err, model)
+		}
+	}
+
+	if debugMode {
+		for _, role := range ai.ModelRoles {
+			fmt.Printf("Model for %s: %s\n", role, ai.ModelFor(role))
+		}
+	}
+	return a
+}
+
+// addAgentFlags registers the flags understood by newAgent
+func addAgentFlags(cmd *cobra.Command) {
+	// Add namespace flag
+	cmd.Flags().StringP("namespace", "n", "", "Default namespace to use for Kubernetes operations")
+
+	// Add debug mode flag
+	cmd.Flags().BoolP("debug", "d", false, "Enable debug mode to see detailed processing information")
+
+	// Add max loops flag
+	cmd.Flags().IntP("max-loops", "m", config.DefaultMaxLoops, "Maximum number of reasoning loops before stopping")
+
+	// Add tool calling flag
+	cmd.Flags().Bool("tool-calling", false, "Use native OpenAI tool calling instead of the ReAct text format (falls back automatically if unsupported)")
+
+	// Add stream flag
+	cmd.Flags().Bool("stream", false, "Stream the model output to the terminal as it is generated")
+
+	// Add context budget flag
+	cmd.Flags().Int("context-budget", 24000, "Estimated token budget of the conversation history before older messages are summarized (0 disables)")
+
+	// Add token budget flag
+	cmd.Flags().Int("max-tokens-budget", 0, "Stop once the session used this many prompt and completion tokens (0 disables)")
+
+	// Add resume flag
+	cmd.Flags().String("resume", "", "Resume a saved session by its ID (see 'kgent sessions list')")
+
+	// Add one-shot flags
+	cmd.Flags().StringP("query", "q", "", "Answer a single query non-interactively and exit ('-' reads the query from stdin)")
+	cmd.Flags().StringP("output", "o", "text", "Output format of one-shot mode: text or json")
+}
+
+// askHuman asks the user to confirm an operation of the model. It returns the error of ctx
+// if the turn is interrupted while waiting for the answer.
+func (a *agent) askHuman(ctx context.Context, prompt string) (string, error) {
+	utils.PrintYellowNoNewline("%s", prompt)
+	answer, err := a.input.readLine(ctx)
+	if err == io.EOF {
+		return "", errors.New("no answer from the user: the input was closed")
+	}
+	return answer, err
+}
+
+// runChatLoop handles the main interaction loop
+func (a *agent) runChatLoop(cmd *cobra.Command) {
+	a.input = newLineReader(cmd.InOrStdin())
+	// Only an interactive session has a user to confirm dangerous operations
+	if t, ok := a.registry.Get("HumanTool"); ok {
+		if human, ok := t.(*tools.HumanTool); ok {
+			human.Ask = a.askHuman
+		}
+	}
+	utils.PrintCyan("Hello, I'm k8s assistant, how can I help you today? (type 'exit' to quit, '/reset' to start a new conversation, '/context <name>' to switch cluster)")
+	a.kubeContext = currentKubeContext()
+
+	for {
+		if a.kubeContext != "" {
+			utils.PrintYellowNoNewline("[%s] > ", a.kubeContext)
+		} else {
+			utils.PrintYellowNoNewline("> ")
+		}
+		input, err := a.input.readLine(context.Background())
+		if err == io.EOF {
+			a.printSessionUsage()
+			break
+		}
+		if err != nil {
+			utils.PrintRed("Error reading input: %v\n", err)
+			return
+		}
+		if input == "" {
+			continue // Skip empty inputs
+		}
+		if input == "exit" {
+			a.printSessionUsage()
+			utils.PrintGreen("Goodbye!")
+			return
+		}
+		if input == "/reset" {
+			// Start a new session so the previous conversation stays resumable
+			a.printSessionUsage()
+			ai.MessageStore.Clear()
+			ai.MessageStore.SetSystem(systemPrompt(a.registry))
+			previous := a.session
+			a.session = session.New(previous.Command, previous.Namespace, ai.ModelName)
+			// The new conversation keeps working on the cluster selected with /context
+			a.session.Context = previous.Context
+			utils.PrintGreen("Conversation history cleared. New session: %s", a.session.ID)
+			continue
+		}
+		if input == "/context" || strings.HasPrefix(input, "/context ") {
+			a.switchContext(strings.TrimSpace(strings.TrimPrefix(input, "/context")))
+			continue
+		}
+
+		a.runTurn(a.withNamespace(input))
+	}
+}
+
+// switchContext makes the following requests work on the cluster of another kubeconfig
+// context, or prints the current context if name is empty
+func (a *agent) switchContext(name string) {
+	if name == "" {
+		if a.kubeContext == "" {
+			utils.PrintYellow("No kubeconfig context is known, use /context <name> to select one")
+			return
+		}
+		utils.PrintCyan("Current context: %s", a.kubeContext)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubectlTimeout)
+	defer cancel()
+	if err := tools.CheckContext(ctx, name); err != nil {
+		utils.PrintRed("Error: %v", err)
+		return
+	}
+
+	config.Active.KubeContext = name
+	a.session.Context = name
+	a.kubeContext = name
+	utils.PrintGreen("Switched to context %s", name)
+}
+
+// currentKubeContext returns the kubeconfig context the tools work on, or an empty string
+// if kubectl cannot tell
+func currentKubeContext() string {
+	ctx, cancel := context.WithTimeout(context.Background(), kubectlTimeout)
+	defer cancel()
+	name, err := tools.CurrentContext(ctx)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// withNamespace adds the default namespace to the input if it does not mention one
+func (a *agent) withNamespace(input string) string {
+	if a.namespace != "" && !regexp.MustCompile(`(?i)namespace`).MatchString(input) {
+		return fmt.Sprintf("%s (in namespace %s)", input, a.namespace)
+	}
+	return input
+}
+
+// runTurn answers a single user input on top of the history of the previous turns
+func (a *agent) runTurn(input string) *session.Turn {
+	turnStart := len(ai.MessageStore)
+	a.turn = &session.Turn{Query: input}
+
+	// Ctrl-C cancels the current turn only: in-flight requests and child processes are
+	// aborted and the user is brought back to the prompt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	a.turnUsageStart = ai.TotalUsage()
+	a.startTurn(input)
+	if a.plan {
+		a.runPlanTurn(ctx)
+	} else {
+		a.processConversation(ctx, input, turnStart)
+	}
+	a.compactTurn(turnStart)
+
+	a.turn.Usage = a.turnUsage()
+	a.session.Usage = a.session.Usage.Add(a.turn.Usage)
+	if a.debugMode {
+		fmt.Printf("Token usage of this request: %s\n", a.turn.Usage)
+		fmt.Printf("Token usage of this session: %s\n", a.session.Usage)
+	}
+	a.saveSession()
+
+	return a.turn
+}
+
+// saveSession persists the conversation after a finished turn
+func (a *agent) saveSession() {
+	if a.session == nil {
+		return
+	}
+
+	a.session.Messages = ai.MessageStore
+	a.session.Turns = append(a.session.Turns, *a.turn)
+	if err := session.Save(a.session); err != nil {
+		utils.PrintYellow("Warning: failed to save session: %v", err)
+	}
+}
+
+// compactTurn replaces the messages of the finished turn with the user input, the tools that
+// were called and the answer, so later turns can refer to earlier resources without carrying
+// the full prompt template and every raw observation.
+func (a *agent) compactTurn(turnStart int) {
+	ai.MessageStore.Truncate(turnStart)
+	ai.MessageStore.AddUser(a.turn.Query)
+
+	var summary strings.Builder
+	if len(a.turn.ToolCalls) > 0 {
+		summary.WriteString("Tools used for this request:\n")
+		for i, call := range a.turn.ToolCalls {
+			output := call.Output
+			if len(output) > maxRecalledOutput {
+				output = strings.ToValidUTF8(output[:maxRecalledOutput], "") + "...(truncated)"
+			}
+			fmt.Fprintf(&summary, "%d. %s %s => %s\n", i+1, call.Name, call.Input, output)
+		}
+	}
+	if a.turn.Answer != "" {
+		summary.WriteString("Answer: " + a.turn.Answer)
+	} else {
+		summary.WriteString("No answer was given for this request.")
+	}
+
+	ai.MessageStore.AppendMessage(summary.String(), ai.RoleAssistant)
+}
+
+// startTurn adds the prompt for a new user input to the message store
+func (a *agent) startTurn(input string) {
+	prompt := a.buildPrompt(input)
+	if a.debugMode {
+		fmt.Println("User prompt:", prompt)
+	}
+	ai.MessageStore.AddUser(prompt)
+	// The prompt carries the tool instructions and must survive context compaction
+	ai.MessageStore.PinLast()
+}
+
+// processConversation handles the AI interaction and tool execution
+func (a *agent) processConversation(ctx context.Context, input string, turnStart int) {
+	for loopCount := 1; loopCount <= a.maxLoops; loopCount++ {
+		if ctx.Err() != nil {
+			a.interruptTurn()
+			return
+		}
+		if !a.checkTokenBudget() {
+			return
+		}
+
+		ai.MessageStore.Fit(ctx, a.contextBudget, keepRecentMessages)
+
+		if a.debugMode {
+			fmt.Printf("---------------- Response round %d ----------------\n", loopCount)
+			printDebugInfo()
+		}
+
+		if a.toolCalling {
+			done, err := a.toolCallingRound(ctx)
+			if ctx.Err() != nil {
+				a.interruptTurn()
+				return
+			}
+			if err == nil {
+				if done || a.turn.Error != "" {
+					return
+				}
+				continue
+			}
+			if !ai.IsToolCallingUnsupported(err) {
+				a.failTurn("Error calling AI API: %v", err)
+				return
+			}
+
+			// The model does not support tool calling: restart the turn in ReAct mode
+			if !a.quiet {
+				utils.PrintYellow("The model does not support tool calling, falling back to the ReAct format.")
+			}
+			a.toolCalling = false
+			ai.MessageStore.Truncate(turnStart)
+			a.startTurn(input)
+		}
+
+		done, err := a.reactRound(ctx, loopCount)
+		if ctx.Err() != nil {
+			a.interruptTurn()
+			return
+		}
+		if err != nil {
+			a.failTurn("Error calling AI API: %v", err)
+			return
+		}
+		if done || a.turn.Error != "" {
+			return
+		}
+	}
+
+	a.turn.Error = maxLoopsError
+	if !a.quiet {
+		utils.PrintYellow("Exceeded maximum number of reasoning loops. Stopping execution.")
+	}
+}
+
+// turnUsage returns the token usage of the current turn so far
+func (a *agent) turnUsage() ai.Usage {
+	return ai.TotalUsage().Sub(a.turnUsageStart)
+}
+
+// checkTokenBudget stops the turn if the session used more tokens than allowed
+func (a *agent) checkTokenBudget() bool {
+	if a.maxTokensBudget <= 0 {
+		return true
+	}
+	used := a.session.Usage.Add(a.turnUsage()).TotalTokens()
+	if used < a.maxTokensBudget {
+		return true
+	}
+
+	a.turn.Error = fmt.Sprintf("%s: %d of %d tokens used", tokenBudgetError, used, a.maxTokensBudget)
+	if !a.quiet {
+		utils.PrintYellow("%s. Stopping execution.", a.turn.Error)
+	}
+	return false
+}
+
+// printSessionUsage prints the token usage of the session when the user leaves it
+func (a *agent) printSessionUsage() {
+	if a.session == nil || a.session.Usage.Calls == 0 {
+		return
+	}
+	fmt.Printf("Token usage of this session: %s\n", a.session.Usage)
+}
+
+// interruptTurn records that the user cancelled the turn with Ctrl-C
+func (a *agent) interruptTurn() {
+	a.turn.Error = "Interrupted by the user"
+	if !a.quiet {
+		fmt.Println()
+		utils.PrintYellow("Interrupted.")
+	}
+}
+
+// failTurn records why the turn ended without an answer and reports it to the user
+func (a *agent) failTurn(format string, args ...interface{}) {
+	a.turn.Error = fmt.Sprintf(format, args...)
+	if !a.quiet {
+		utils.PrintRed("%s", a.turn.Error)
+	}
+}
+
+// reactRound runs one round of the ReAct text protocol and reports whether the turn is finished
+func (a *agent) reactRound(ctx context.Context, loopCount int) (bool, error) {
+	if !a.stream {
+		response, err := ai.Chat(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage(), ai.ReActStop...)
+		if err != nil {
+			return false, err
+		}
+		return a.handleReactResponse(ctx, response, loopCount, false), nil
+	}
+
+	printer := newStreamPrinter(a.debugMode)
+	response, err := ai.ChatStream(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage(), nil, ai.ReActStop, printer.onDelta)
+	printer.finish()
+	if err != nil {
+		return false, err
+	}
+	return a.handleReactResponse(ctx, response, loopCount, printer.answered()), nil
+}
+
+// handleReactResponse prints the final answer or executes the action contained in a ReAct response.
+// streamed is set when the response has already been rendered while it was generated.
+func (a *agent) handleReactResponse(ctx context.Context, response openai.ChatCompletionMessage, loopCount int, streamed bool) bool {
+	if a.debugMode && !streamed {
+		fmt.Println("# Response from LLM:")
+		fmt.Println(response.Content)
+		fmt.Println()
+	}
+
+	parsed, err := parser.Parse(response.Content)
+
+	// A pending action always wins over a final answer given in the same response,
+	// as that answer cannot be based on the result of the action
+	if parsed.HasFinalAnswer && len(parsed.Actions) == 0 && err == nil {
+		a.turn.Answer = parsed.FinalAnswer
+		if !streamed {
+			a.printFinalAnswer(parsed.FinalAnswer, response.Content)
+		}
+		return true
+	}
+
+	if !a.debugMode && !a.quiet {
+		// In non-debug mode, don't print intermediate thinking
+		utils.PrintCyan("Thinking...")
+	}
+
+	// Strip the observation and final answer the model made up instead of waiting for the tool
+	if parsed.Cleaned != response.Content {
+		if a.debugMode {
+			fmt.Println("# Discarded made-up content:")
+			fmt.Println(strings.TrimPrefix(response.Content, parsed.Cleaned))
+		}
+		response.Content = parsed.Cleaned
+	}
+
+	ai.MessageStore.AddAssistant(response)
+
+	// Ask the model to fix its format instead of wasting the round
+	if err != nil {
+		correction := fmt.Sprintf(promptTpl.FormatCorrectionTemplate, err, a.registry.Names())
+		if a.debugMode {
+			fmt.Printf("# Round %d format correction:\n", loopCount)
+			fmt.Println(correction)
+		}
+		ai.MessageStore.AddUser(correction)
+		return false
+	}
+
+	// Process the actions in the order they were given
+	observations := make([]string, 0, len(parsed.Actions))
+	for _, action := range parsed.Actions {
+		result := a.handleAction(ctx, action.Name, string(action.Input))
+		if len(parsed.Actions) == 1 {
+			observations = append(observations, "Observation: "+result)
+		} else {
+			observations = append(observations, fmt.Sprintf("Observation (%s): %s", action.Name, result))
+		}
+	}
+
+	// Add the observation as a user message
+	prompt := response.Content + "\n" + strings.Join(observations, "\n")
+
+	if a.debugMode {
+		fmt.Printf("# Round %d user prompt:\n", loopCount)
+		fmt.Println(prompt)
+	}
+
+	ai.MessageStore.AddUser(prompt)
+
+	return false
+}
+
+// toolCallingRound runs one round with native tool calling and reports whether the turn is finished
+func (a *agent) toolCallingRound(ctx context.Context) (bool, error) {
+	toolDefs, err := a.registry.OpenAITools()
+	if err != nil {
+		return false, err
+	}
+
+	// The content of a response is the answer only if it has no tool calls, which is known at
+	// its end, so a streamed response is not printed as it arrives
+	var response openai.ChatCompletionMessage
+	if a.stream {
+		response, err = ai.ChatStream(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage(), toolDefs, nil, nil)
+	} else {
+		response, err = ai.ChatWithTools(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage(), toolDefs)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if len(response.ToolCalls) == 0 {
+		// Some models ignore the tool definitions and still answer in the ReAct format
+		if strings.Contains(response.Content, "Action:") || strings.Contains(response.Content, "Final Answer:") {
+			return a.handleReactResponse(ctx, response, 0, false), nil
+		}
+
+		a.turn.Answer = strings.TrimSpace(response.Content)
+		if a.debugMode {
+			fmt.Println("# Response from LLM:")
+			fmt.Println(response.Content)
+			fmt.Println()
+		}
+		a.printFinalAnswer(strings.TrimSpace(response.Content), response.Content)
+		return true, nil
+	}
+
+	if !a.debugMode && !a.quiet {
+		utils.PrintCyan("Thinking...")
+	}
+
+	ai.MessageStore.AddAssistant(response)
+	for _, call := range response.ToolCalls {
+		result := a.handleAction(ctx, call.Function.Name, call.Function.Arguments)
+		ai.MessageStore.AddToolResult(call.ID, call.Function.Name, result)
+	}
+
+	return false, nil
+}
+
+// printFinalAnswer prints the answer, or the whole response in debug mode
+func (a *agent) printFinalAnswer(answer string, content string) {
+	// In quiet mode the caller decides how to output the answer
+	if a.quiet {
+		return
+	}
+
+	// Print only the final answer in non-debug mode
+	if !a.debugMode {
+		utils.PrintCyan(answer)
+	} else {
+		utils.PrintCyan("# Final Answer from LLM:")
+		utils.PrintCyan(content)
+		utils.PrintCyan("-------------------------------------------------")
+	}
+}
+
+// handleAction executes the registered tool named by the action and returns the observation
+func (a *agent) handleAction(ctx context.Context, action string, actionInput string) string {
+	output, err := a.callTool(ctx, action, actionInput)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return output
+}
+
+// callTool executes the registered tool named by the action and records the call in the turn
+func (a *agent) callTool(ctx context.Context, action string, actionInput string) (string, error) {
+	if a.debugMode {
+		fmt.Println("# Action Debug:")
+		fmt.Println("Action:", action)
+		fmt.Println("Action Input:", actionInput)
+	}
+
+	var result string
+
+	output, err := a.registry.Run(ctx, strings.TrimSpace(action), json.RawMessage(actionInput))
+	if err != nil {
+		result = fmt.Sprintf("Error: %v", err)
+		// The model cannot fix the credentials, so the turn ends and the user is told how to
+		if hint := backendAuthHint(err); hint != "" {
+			a.failTurn("%v. %s", err, hint)
+		}
+	} else {
+		result = output.Output
+	}
+
+	a.turn.ToolCalls = append(a.turn.ToolCalls, session.ToolCall{
+		Name:   strings.TrimSpace(action),
+		Input:  strings.TrimSpace(actionInput),
+		Output: result,
+	})
+
+	if a.debugMode {
+		fmt.Println("Result:", result)
+	}
+
+	return output.Output, err
+}
+
+// printDebugInfo prints debug information about the message store
+func printDebugInfo() {
+	fmt.Println("# Message Store Debug:")
+	fmt.Printf("Number of messages: %d, Estimated tokens: %d\n", len(ai.MessageStore), ai.MessageStore.TokenCount())
+	for i, msg := range ai.MessageStore {
+		fmt.Printf("Message %d: Role=%s, Content length=%d, Tokens=%d, Compacted=%t\n",
+			i, msg.Msg.Role, len(msg.Msg.Content), msg.Tokens, msg.Compacted)
+	}
+}
+
+// buildPrompt renders the prompt for the user query in the current protocol
+func (a *agent) buildPrompt(query string) string {
+	if a.toolCalling && !a.plan {
+		// Tool definitions are sent alongside the request, so only the rules are needed
+		return fmt.Sprintf(promptTpl.ToolCallingTemplate, query)
+	}
+
+	toolsList := make([]string, 0)
+	for _, t := range a.registry.Tools() {
+		toolsList = append(toolsList, "Name: "+t.Name()+"\nDescription: "+t.Description()+"\nArgsSchema: "+t.ArgsSchema()+"\n")
+	}
+
+	if a.plan {
+		return fmt.Sprintf(promptTpl.PlanTemplate, toolsList, a.registry.Names(), query)
+	}
+
+	prompt := fmt.Sprintf(promptTpl.Template, toolsList, a.registry.Names(), query)
+
+	return prompt
+}
@@ -0,0 +1,364 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// anthropicVersion is the version of the Messages API kgent is written against
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens is the completion limit of requests that do not set one, as the
+	// Messages API requires it
+	anthropicMaxTokens = 4096
+)
+
+// anthropicProvider talks to the Anthropic Messages API
+type anthropicProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// anthropicBlock is a content block of a message
+type anthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// ID, Name and Input describe a tool_use block
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// ToolUseID and Content describe a tool_result block
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// anthropicMessage is a message of the Messages API
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicTool is a tool definition of the Messages API
+type anthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+// anthropicRequest is the body of /v1/messages
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// anthropicUsage is the token usage of a call
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicResponse is the response of /v1/messages
+type anthropicResponse struct {
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// newAnthropicProvider creates a provider for the Anthropic Messages API
+func newAnthropicProvider(cfg ProviderConfig) *anthropicProvider {
+	return &anthropicProvider{
+		apiKey:  cfg.APIKey,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		client:  newHTTPClient(),
+	}
+}
+
+// Name returns the provider type
+func (p *anthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+// headers returns the authentication and version headers of every request
+func (p *anthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+// CreateChatCompletion performs a chat completion call
+func (p *anthropicProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	rsp, err := postJSON(ctx, p.client, p.baseURL+"/v1/messages", p.headers(), newAnthropicRequest(req, false))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer rsp.Body.Close()
+
+	var body anthropicResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	msg := openai.ChatCompletionMessage{Role: RoleAssistant}
+	var content strings.Builder
+	for _, block := range body.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(block.Input),
+				},
+			})
+		}
+	}
+	msg.Content = content.String()
+
+	return openai.ChatCompletionResponse{
+		Model: body.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      msg,
+			FinishReason: anthropicFinishReason(body.StopReason),
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     body.Usage.InputTokens,
+			CompletionTokens: body.Usage.OutputTokens,
+			TotalTokens:      body.Usage.InputTokens + body.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// anthropicFinishReason maps a stop reason of the Messages API to the OpenAI finish reason
+func anthropicFinishReason(stopReason string) openai.FinishReason {
+	switch stopReason {
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "":
+		return ""
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// CreateChatCompletionStream performs a streamed chat completion call
+func (p *anthropicProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (CompletionStream, error) {
+	rsp, err := postJSON(ctx, p.client, p.baseURL+"/v1/messages", p.headers(), newAnthropicRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicStream{
+		body:      rsp.Body,
+		reader:    bufio.NewReader(rsp.Body),
+		toolIndex: map[int]int{},
+	}, nil
+}
+
+// newAnthropicRequest translates an OpenAI request to the Messages API. System messages are
+// moved to the system parameter, tool results become tool_result blocks of a user message and
+// consecutive messages of the same role are merged, as the API expects alternating roles.
+func newAnthropicRequest(req openai.ChatCompletionRequest, stream bool) anthropicRequest {
+	out := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		StopSequences: req.Stop,
+		Stream:        stream,
+	}
+	if out.MaxTokens == 0 {
+		out.MaxTokens = anthropicMaxTokens
+	}
+
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: t.Function.Parameters,
+		})
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		role := RoleUser
+		var blocks []anthropicBlock
+
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, strings.TrimSpace(msg.Content))
+			continue
+		case RoleTool:
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		case RoleAssistant:
+			role = RoleAssistant
+			if strings.TrimSpace(msg.Content) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: jsonObject(call.Function.Arguments),
+				})
+			}
+		default:
+			if strings.TrimSpace(msg.Content) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+		}
+
+		// Empty text blocks are rejected by the API
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	return out
+}
+
+// anthropicEvent is a server-sent event of a streamed response
+type anthropicEvent struct {
+	Type         string          `json:"type"`
+	Index        int             `json:"index"`
+	Message      json.RawMessage `json:"message"`
+	ContentBlock anthropicBlock  `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStream converts the server-sent events of a streamed response into OpenAI chunks
+type anthropicStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	// toolIndex maps the content block index of tool_use blocks to their tool call index
+	toolIndex map[int]int
+	model     string
+	usage     anthropicUsage
+	done      bool
+}
+
+// Recv returns the next chunk of the response
+func (s *anthropicStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		if s.done {
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		}
+
+		line, err := s.reader.ReadString('\n')
+		data, isData := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !isData {
+			if err != nil {
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			continue
+		}
+
+		var event anthropicEvent
+		if jsonErr := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); jsonErr != nil {
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("failed to decode anthropic stream: %w", jsonErr)
+		}
+
+		switch event.Type {
+		case "message_start":
+			var start struct {
+				Model string         `json:"model"`
+				Usage anthropicUsage `json:"usage"`
+			}
+			if json.Unmarshal(event.Message, &start) == nil {
+				s.model = start.Model
+				s.usage.InputTokens = start.Usage.InputTokens
+			}
+		case "content_block_start":
+			if event.ContentBlock.Type != "tool_use" {
+				continue
+			}
+			index := len(s.toolIndex)
+			s.toolIndex[event.Index] = index
+			return s.chunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+				Index:    &index,
+				ID:       event.ContentBlock.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: event.ContentBlock.Name},
+			}}}), nil
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				return s.chunk(openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}), nil
+			case "input_json_delta":
+				index := s.toolIndex[event.Index]
+				return s.chunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+					Index:    &index,
+					Function: openai.FunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}), nil
+			}
+		case "message_delta":
+			s.usage.OutputTokens = event.Usage.OutputTokens
+			if event.Delta.StopReason != "" {
+				out := s.chunk(openai.ChatCompletionStreamChoiceDelta{})
+				out.Choices[0].FinishReason = anthropicFinishReason(event.Delta.StopReason)
+				return out, nil
+			}
+		case "message_stop":
+			s.done = true
+			return openai.ChatCompletionStreamResponse{
+				Model: s.model,
+				Usage: &openai.Usage{
+					PromptTokens:     s.usage.InputTokens,
+					CompletionTokens: s.usage.OutputTokens,
+					TotalTokens:      s.usage.InputTokens + s.usage.OutputTokens,
+				},
+			}, nil
+		case "error":
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("anthropic: %s: %s", event.Error.Type, event.Error.Message)
+		}
+	}
+}
+
+// chunk wraps a delta into a stream chunk
+func (s *anthropicStream) chunk(delta openai.ChatCompletionStreamChoiceDelta) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Model:   s.model,
+		Choices: []openai.ChatCompletionStreamChoice{{Delta: delta}},
+	}
+}
+
+// Close releases the connection
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
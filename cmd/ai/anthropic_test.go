@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// anthropicSSE renders server-sent events of the Messages API
+func anthropicSSE(events ...string) string {
+	var s strings.Builder
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(event), &typed)
+		s.WriteString("event: " + typed.Type + "\ndata: " + event + "\n\n")
+	}
+	return s.String()
+}
+
+func TestAnthropic(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []openai.ChatCompletionMessage
+		tools    []openai.Tool
+		stop     []string
+		stream   bool
+		reply    string
+		// wantSystem and wantMessages are the system parameter and the messages of the request
+		wantSystem   string
+		wantMessages string
+		wantTools    string
+		want         exchange
+		wantErr      string
+	}{
+		{
+			name: "text answer",
+			messages: []openai.ChatCompletionMessage{
+				{Role: RoleSystem, Content: "You are a Kubernetes expert."},
+				{Role: RoleSystem, Content: "Be brief."},
+				{Role: RoleUser, Content: "hello"},
+				{Role: RoleUser, Content: "list the pods"},
+			},
+			stop:         []string{"Observation:"},
+			reply:        `{"model":"claude","content":[{"type":"text","text":"Final Answer: "},{"type":"text","text":"none"}],"stop_reason":"stop_sequence","usage":{"input_tokens":12,"output_tokens":3}}`,
+			wantSystem:   "You are a Kubernetes expert.\n\nBe brief.",
+			wantMessages: `[{"role":"user","content":[{"type":"text","text":"hello"},{"type":"text","text":"list the pods"}]}]`,
+			want:         exchange{content: "Final Answer: none", finish: openai.FinishReasonStop, usage: openai.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}},
+		},
+		{
+			name:       "tool call round trip",
+			messages:   toolRoundTrip,
+			tools:      []openai.Tool{listTool},
+			reply:      `{"model":"claude","content":[{"type":"text","text":"Checking the services too."},{"type":"tool_use","id":"toolu_2","name":"ListTool","input":{"resource":"service"}}],"stop_reason":"tool_use","usage":{"input_tokens":40,"output_tokens":20}}`,
+			wantSystem: "You are a Kubernetes expert.",
+			wantMessages: `[{"role":"user","content":[{"type":"text","text":"list the pods"}]},` +
+				`{"role":"assistant","content":[{"type":"tool_use","id":"call_1","name":"ListTool","input":{"resource":"pod"}}]},` +
+				`{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"[\"web\"]"}]}]`,
+			wantTools: `[{"name":"ListTool","description":"Lists resources","input_schema":{"type":"object"}}]`,
+			want: exchange{
+				content: "Checking the services too.",
+				calls:   []string{`toolu_2 ListTool {"resource":"service"}`},
+				finish:  openai.FinishReasonToolCalls,
+				usage:   openai.Usage{PromptTokens: 40, CompletionTokens: 20, TotalTokens: 60},
+			},
+		},
+		{
+			name:       "streamed tool call",
+			messages:   toolRoundTrip,
+			tools:      []openai.Tool{listTool},
+			stream:     true,
+			wantSystem: "You are a Kubernetes expert.",
+			wantMessages: `[{"role":"user","content":[{"type":"text","text":"list the pods"}]},` +
+				`{"role":"assistant","content":[{"type":"tool_use","id":"call_1","name":"ListTool","input":{"resource":"pod"}}]},` +
+				`{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"[\"web\"]"}]}]`,
+			wantTools: `[{"name":"ListTool","description":"Lists resources","input_schema":{"type":"object"}}]`,
+			reply: anthropicSSE(
+				`{"type":"message_start","message":{"model":"claude","usage":{"input_tokens":40,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking "}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the services."}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"ping"}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_2","name":"ListTool","input":{}}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"resource\":"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"service\"}"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}`,
+				`{"type":"message_stop"}`,
+			),
+			want: exchange{
+				content: "Checking the services.",
+				calls:   []string{`toolu_2 ListTool {"resource":"service"}`},
+				finish:  openai.FinishReasonToolCalls,
+				usage:   openai.Usage{PromptTokens: 40, CompletionTokens: 25, TotalTokens: 65},
+			},
+		},
+		{
+			name:     "streamed text cut by the token limit",
+			messages: []openai.ChatCompletionMessage{{Role: RoleUser, Content: "explain pods"}},
+			stream:   true,
+			reply: anthropicSSE(
+				`{"type":"message_start","message":{"model":"claude","usage":{"input_tokens":5,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"A pod is"}}`,
+				`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":3}}`,
+				`{"type":"message_stop"}`,
+			),
+			wantMessages: `[{"role":"user","content":[{"type":"text","text":"explain pods"}]}]`,
+			want:         exchange{content: "A pod is", finish: openai.FinishReasonLength, usage: openai.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}},
+		},
+		{
+			name:         "error event in the stream",
+			messages:     []openai.ChatCompletionMessage{{Role: RoleUser, Content: "hello"}},
+			stream:       true,
+			reply:        anthropicSSE(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+			wantMessages: `[{"role":"user","content":[{"type":"text","text":"hello"}]}]`,
+			wantErr:      "anthropic: overloaded_error: Overloaded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType := "application/json"
+			if tt.stream {
+				contentType = "text/event-stream"
+			}
+			server := newProviderServer(t, contentType, tt.reply)
+			p := newAnthropicProvider(ProviderConfig{APIKey: "sk-ant", BaseURL: server.URL + "/"})
+
+			got, err := complete(t, p, openai.ChatCompletionRequest{Model: "claude", Messages: tt.messages, Tools: tt.tools, Stop: tt.stop}, tt.stream)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %s", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				checkExchange(t, got, tt.want)
+			}
+
+			if server.path != "/v1/messages" || server.header.Get("x-api-key") != "sk-ant" || server.header.Get("anthropic-version") != anthropicVersion {
+				t.Errorf("request to %s with headers %v", server.path, server.header)
+			}
+			var req anthropicRequest
+			if err := json.Unmarshal([]byte(server.request), &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.System != tt.wantSystem {
+				t.Errorf("system = %q, want %q", req.System, tt.wantSystem)
+			}
+			if messages, _ := json.Marshal(req.Messages); string(messages) != tt.wantMessages {
+				t.Errorf("messages = %s\nwant %s", messages, tt.wantMessages)
+			}
+			if tools, _ := json.Marshal(req.Tools); tt.wantTools != "" && string(tools) != tt.wantTools {
+				t.Errorf("tools = %s\nwant %s", tools, tt.wantTools)
+			}
+			if req.MaxTokens != anthropicMaxTokens || req.Stream != tt.stream || strings.Join(req.StopSequences, ",") != strings.Join(tt.stop, ",") {
+				t.Errorf("max_tokens = %d, stream = %v, stop_sequences = %q", req.MaxTokens, req.Stream, req.StopSequences)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	promptTpl "kgent/cmd/prompt"
+)
+
+const (
+	// messageOverheadTokens accounts for the role and separators added to every message
+	messageOverheadTokens = 4
+	// compactThresholdTokens is the minimum size of a message worth summarizing
+	compactThresholdTokens = 200
+	// truncatedMessageTokens is the size a message is cut down to when summarization fails
+	truncatedMessageTokens = 150
+)
+
+// EstimateTokens returns a rough token count for text: about four ASCII characters per token,
+// and one token per non-ASCII character, which is conservative for CJK text.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimateMessageTokens returns a rough token count for a message including its tool calls
+func EstimateMessageTokens(msg openai.ChatCompletionMessage) int {
+	tokens := messageOverheadTokens + EstimateTokens(msg.Content)
+	for _, call := range msg.ToolCalls {
+		tokens += EstimateTokens(call.Function.Name) + EstimateTokens(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// TokenCount returns the estimated number of tokens of the whole chat history
+func (cm *ChatMessages) TokenCount() int {
+	total := 0
+	for _, msg := range *cm {
+		total += msg.Tokens
+	}
+	return total
+}
+
+// PinLast protects the last message from being compacted by Fit
+func (cm *ChatMessages) PinLast() {
+	if len(*cm) > 0 {
+		(*cm)[len(*cm)-1].Pinned = true
+	}
+}
+
+// Fit shrinks the chat history until its estimated size is within budget tokens. The system
+// prompt, pinned messages and the last keepRecent messages are never touched; older messages
+// are summarized with a secondary LLM call, oldest first, and truncated if summarization fails.
+// A budget of zero or less disables the limit.
+func (cm *ChatMessages) Fit(ctx context.Context, budget int, keepRecent int) {
+	if budget <= 0 {
+		return
+	}
+
+	for i := 1; i < len(*cm)-keepRecent && cm.TokenCount() > budget; i++ {
+		msg := (*cm)[i]
+		if msg.Pinned || msg.Compacted || msg.Tokens < compactThresholdTokens || msg.Msg.Content == "" {
+			continue
+		}
+
+		content, err := summarize(ctx, msg.Msg.Content)
+		if err != nil || EstimateTokens(content) >= msg.Tokens {
+			content = truncateTokens(msg.Msg.Content, truncatedMessageTokens)
+		}
+
+		msg.Msg.Content = content
+		msg.Tokens = EstimateMessageTokens(msg.Msg)
+		msg.Compacted = true
+	}
+}
+
+// summarize asks the model to condense a message of the conversation
+func summarize(ctx context.Context, content string) (string, error) {
+	rsp, err := createChatCompletion(ctx, ModelSummarization, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: RoleSystem, Content: promptTpl.SummarizePrompt},
+			{Role: RoleUser, Content: content},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[Summary of an earlier message] %s", rsp.Content), nil
+}
+
+// truncateTokens keeps roughly the first tokens tokens of text
+func truncateTokens(text string, tokens int) string {
+	kept := 0
+	for i, r := range text {
+		if r < utf8.RuneSelf {
+			kept++
+		} else {
+			kept += 4
+		}
+		if kept > tokens*4 {
+			return text[:i] + "\n...(truncated to save context)"
+		}
+	}
+	return text
+}
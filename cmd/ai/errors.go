@@ -0,0 +1,219 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"kgent/cmd/cassette"
+)
+
+// Kinds of API errors, match them with errors.Is
+var (
+	ErrRateLimited   = errors.New("the model API rate limited the request")
+	ErrServer        = errors.New("the model API failed with a server error")
+	ErrTimeout       = errors.New("the model API did not answer in time")
+	ErrUnauthorized  = errors.New("the model API rejected the credentials")
+	ErrRejected      = errors.New("the model API rejected the request")
+	ErrEmptyResponse = errors.New("the model API returned an empty response")
+	ErrUnreachable   = errors.New("the model API could not be reached")
+)
+
+// Retry settings of calls to the model API
+var (
+	// MaxRetries is the number of times a failed call is retried
+	MaxRetries = 3
+	// RetryBaseDelay is the delay before the first retry, doubled on every attempt
+	RetryBaseDelay = time.Second
+	// RetryMaxDelay caps the backoff delay and the Retry-After delay that is honored
+	RetryMaxDelay = 30 * time.Second
+)
+
+// OnRetry is called before a failed call is retried, e.g. to let the user know why it is slow
+var OnRetry func(err error, attempt int, delay time.Duration)
+
+// Error is a failed call to the model API
+type Error struct {
+	// Kind is one of the Err* variables
+	Kind error
+	// StatusCode is the HTTP status of the response, if any
+	StatusCode int
+	// RetryAfter is the delay requested by the Retry-After header
+	RetryAfter time.Duration
+	// Attempts is the number of calls made before giving up
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	var s strings.Builder
+	s.WriteString(e.Kind.Error())
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&s, " (HTTP %d)", e.StatusCode)
+	}
+	if e.Attempts > 1 {
+		fmt.Fprintf(&s, " after %d attempts", e.Attempts)
+	}
+	if e.Err != nil && e.Err != e.Kind {
+		fmt.Fprintf(&s, ": %v", e.Err)
+	}
+	return s.String()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Retryable reports whether calling again may succeed
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrRateLimited, ErrServer, ErrTimeout, ErrEmptyResponse:
+		return true
+	default:
+		return false
+	}
+}
+
+// classify wraps an error of a provider into an *Error. Cancellation by the caller is
+// returned as is, since it is not a failure of the API.
+func classify(ctx context.Context, err error, retryAfter time.Duration) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	e := &Error{Err: err, RetryAfter: retryAfter}
+	var openaiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &openaiErr):
+		e.StatusCode = openaiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		e.StatusCode = reqErr.HTTPStatusCode
+	}
+
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case e.StatusCode >= 500:
+		e.Kind = ErrServer
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		e.Kind = ErrUnauthorized
+	case e.StatusCode != 0:
+		e.Kind = ErrRejected
+	case errors.Is(err, ErrEmptyResponse):
+		e.Kind = ErrEmptyResponse
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		e.Kind = ErrTimeout
+	default:
+		e.Kind = ErrUnreachable
+	}
+	return e
+}
+
+// withRetry calls fn until it succeeds, fails with an error that is not worth retrying or
+// MaxRetries retries were made. Delays grow exponentially with jitter, and the Retry-After
+// header of the response is honored.
+func withRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		err := classify(ctx, fn(withRetryAfter(ctx, &retryAfter)), retryAfter)
+
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		if !apiErr.Retryable() || attempt > MaxRetries {
+			apiErr.Attempts = attempt
+			return apiErr
+		}
+
+		delay := backoff(attempt, apiErr.RetryAfter)
+		if OnRetry != nil {
+			OnRetry(apiErr, attempt, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the given retry: the Retry-After delay if the API asked for
+// one, otherwise an exponential delay with jitter, both capped at RetryMaxDelay
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, RetryMaxDelay)
+	}
+	delay := min(RetryBaseDelay<<(attempt-1), RetryMaxDelay)
+	// Keep at least half of the delay and randomize the rest, so clients do not retry in sync
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfterKey is the context key of the Retry-After holder of a call
+type retryAfterKey struct{}
+
+// withRetryAfter returns a context that lets the transport report the Retry-After header
+func withRetryAfter(ctx context.Context, holder *time.Duration) context.Context {
+	return context.WithValue(ctx, retryAfterKey{}, holder)
+}
+
+// retryAfterTransport records the Retry-After header of responses in the holder of the
+// request context, as the API clients do not expose the headers of failed calls
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip performs the request and records the Retry-After header
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return rsp, err
+	}
+	if holder, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		*holder = parseRetryAfter(rsp.Header.Get("Retry-After"))
+	}
+	return rsp, nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// newHTTPClient returns the HTTP client of the providers
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: retryAfterTransport{base: cassette.Transport(http.DefaultTransport)}}
+}
@@ -2,24 +2,31 @@ package ai
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"time"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
 
-	"github.com/joho/godotenv"
 	openai "github.com/sashabaranov/go-openai"
 
+	"kgent/cmd/config"
 	promptTpl "kgent/cmd/prompt"
-	"kgent/cmd/utils"
 )
 
 // Global variables to store configuration and message history
-var MessageStore ChatMessages
+var MessageStore = newChatMessages()
 var ModelName string
-var Token string
-var DashScopeURL string
+
+// ActiveProvider is the configured provider, see Setup. Requests are routed to the provider
+// of the model of their role, see ConfigureModels.
+var ActiveProvider Provider
+
+// RequestTimeout is the timeout of every attempt of a model call that is not streamed
+var RequestTimeout = config.DefaultModelTimeout
+
+// ReActStop are the stop sequences of the ReAct format: the model must not write the
+// observation of an action itself
+var ReActStop = []string{"Observation:"}
 
 // Role constants for chat messages
 const (
@@ -34,56 +41,58 @@ type ChatMessages []*ChatMessage
 
 // ChatMessage represents a single message in the chat
 type ChatMessage struct {
-	Msg openai.ChatCompletionMessage
+	Msg openai.ChatCompletionMessage `json:"msg"`
+	// Tokens is the estimated number of tokens the message takes in the context window
+	Tokens int `json:"tokens"`
+	// Compacted is set once the content has been summarized or truncated to save context
+	Compacted bool `json:"compacted,omitempty"`
+	// Pinned messages are never compacted
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// newChatMessage wraps an API message and estimates its size
+func newChatMessage(msg openai.ChatCompletionMessage) *ChatMessage {
+	return &ChatMessage{
+		Msg:    msg,
+		Tokens: EstimateMessageTokens(msg),
+	}
+}
+
+// newChatMessages returns a chat history with the system prompt
+func newChatMessages() ChatMessages {
+	cm := make(ChatMessages, 0)
+	cm.Clear()
+	return cm
 }
 
 // Clear initializes or resets the chat history
 func (cm *ChatMessages) Clear() {
 	*cm = make([]*ChatMessage, 0)
 	cm.AddSystem(promptTpl.SystemPrompt)
+	cm.PinLast()
 }
 
-func init() {
-	// Load .env file if it exists
-	workDir, _ := os.Getwd()
-	envPath := filepath.Join(workDir, ".env")
-	err := godotenv.Load(envPath)
+// Setup selects the provider and the model of every role from the environment and the profile
+func Setup(profile config.Profile) error {
+	cfg := ProviderConfigFromEnv(profile)
+	ModelName = cfg.Model
+	provider, err := NewProvider(cfg)
 	if err != nil {
-		log.Println("Warning: .env file not found, using environment variables directly")
+		return err
 	}
-
-	// Set environment variables
-	Token = utils.GetEnv("DASH_SCOPE_API_KEY", "")
-	ModelName = utils.GetEnv("DASH_SCOPE_MODEL", "qwen-max")
-	DashScopeURL = utils.GetEnv("DASH_SCOPE_URL", "https://dashscope.aliyuncs.com/compatible-mode/v1")
-
-	// Check for missing configuration
-	if Token == "" {
-		log.Println("Error: DASH_SCOPE_API_KEY is not set. Please set this environment variable.")
-		os.Exit(1)
+	if err := ConfigureModels(provider, cfg, ModelsConfigFromEnv()); err != nil {
+		return err
 	}
-
-	// Initialize message store
-	MessageStore = make(ChatMessages, 0)
-	MessageStore.Clear()
-}
-
-// NewOpenAiClient creates a new client with the configured API key and URL
-func NewOpenAiClient() *openai.Client {
-	config := openai.DefaultConfig(Token)
-	config.BaseURL = DashScopeURL
-
-	return openai.NewClientWithConfig(config)
+	ActiveProvider = provider
+	return nil
 }
 
 // AppendMessage appends a message with the specified role
 func (cm *ChatMessages) AppendMessage(msg string, role string) {
-	*cm = append(*cm, &ChatMessage{
-		Msg: openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg,
-		},
-	})
+	*cm = append(*cm, newChatMessage(openai.ChatCompletionMessage{
+		Role:    role,
+		Content: msg,
+	}))
 }
 
 // GetMessage converts the chat history to a format suitable for the API
@@ -97,14 +106,22 @@ func (cm *ChatMessages) GetMessage() []openai.ChatCompletionMessage {
 
 // AddToolCall adds a tool call to the chat history
 func (cm *ChatMessages) AddToolCall(rsp openai.ChatCompletionMessage, role string) {
-	*cm = append(*cm, &ChatMessage{
-		Msg: openai.ChatCompletionMessage{
-			Role:         role,
-			Content:      rsp.Content,
-			FunctionCall: rsp.FunctionCall,
-			ToolCalls:    rsp.ToolCalls,
-		},
-	})
+	*cm = append(*cm, newChatMessage(openai.ChatCompletionMessage{
+		Role:         role,
+		Content:      rsp.Content,
+		FunctionCall: rsp.FunctionCall,
+		ToolCalls:    rsp.ToolCalls,
+	}))
+}
+
+// AddToolResult adds the result of a native tool call, linked to the call by its ID
+func (cm *ChatMessages) AddToolResult(toolCallID string, name string, result string) {
+	*cm = append(*cm, newChatMessage(openai.ChatCompletionMessage{
+		Role:       RoleTool,
+		Content:    result,
+		Name:       name,
+		ToolCallID: toolCallID,
+	}))
 }
 
 // AddSystem adds a system message
@@ -112,6 +129,18 @@ func (cm *ChatMessages) AddSystem(msg string) {
 	cm.AppendMessage(msg, RoleSystem)
 }
 
+// SetSystem replaces the system prompt at the start of the chat history, or adds it if the
+// history has none
+func (cm *ChatMessages) SetSystem(msg string) {
+	system := newChatMessage(openai.ChatCompletionMessage{Role: RoleSystem, Content: msg})
+	system.Pinned = true
+	if len(*cm) > 0 && (*cm)[0].Msg.Role == RoleSystem {
+		(*cm)[0] = system
+		return
+	}
+	*cm = append(ChatMessages{system}, *cm...)
+}
+
 // AddAssistant adds an assistant message
 func (cm *ChatMessages) AddAssistant(rsp openai.ChatCompletionMessage) {
 	cm.AddToolCall(rsp, RoleAssistant)
@@ -122,6 +151,13 @@ func (cm *ChatMessages) AddUser(msg string) {
 	cm.AppendMessage(msg, RoleUser)
 }
 
+// Truncate drops every message after the first n messages
+func (cm *ChatMessages) Truncate(n int) {
+	if n < len(*cm) {
+		*cm = (*cm)[:n]
+	}
+}
+
 // GetLast returns the last message in the chat history
 func (cm *ChatMessages) GetLast() string {
 	if len(*cm) == 0 {
@@ -131,33 +167,197 @@ func (cm *ChatMessages) GetLast() string {
 	return (*cm)[len(*cm)-1].Msg.Content
 }
 
-// Chat sends a message to the AI API and returns the response
-func Chat(message []openai.ChatCompletionMessage) openai.ChatCompletionMessage {
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// Chat sends a message to the model of the role and returns the response. Generation stops
+// at any of the optional stop sequences. Failed calls are retried, then the fallback models
+// are tried, and an *Error is returned once they all fail, so it is never mistaken for a
+// response of the model.
+func Chat(ctx context.Context, role ModelRole, message []openai.ChatCompletionMessage, stop ...string) (openai.ChatCompletionMessage, error) {
+	return createChatCompletion(ctx, role, openai.ChatCompletionRequest{
+		Messages: message,
+		Stop:     stop,
+	})
+}
 
-	c := NewOpenAiClient()
-	rsp, err := c.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:    ModelName,
+// ChatWithTools sends a message to the model of the role together with the function
+// definitions of the available tools, so the model can answer with native tool calls.
+func ChatWithTools(ctx context.Context, role ModelRole, message []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionMessage, error) {
+	return createChatCompletion(ctx, role, openai.ChatCompletionRequest{
 		Messages: message,
+		Tools:    tools,
 	})
+}
+
+// ChatStream sends a message to the AI API and streams the response. onDelta is called with
+// every content fragment as it arrives and can return false to stop reading the stream early,
+// in which case the message contains the content received so far. Streamed responses are not
+// bound by a fixed timeout, so long generations are not cut off; cancel ctx to abort them.
+func ChatStream(ctx context.Context, role ModelRole, message []openai.ChatCompletionMessage, tools []openai.Tool, stop []string, onDelta func(delta string) bool) (openai.ChatCompletionMessage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	req := openai.ChatCompletionRequest{
+		Messages: message,
+		Tools:    tools,
+		Stop:     stop,
+		Stream:   true,
+		// Ask for the token usage in the last chunk of the stream
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+
+	// Only opening the stream is retried: once content was delivered it cannot be taken back
+	var stream CompletionStream
+	err := withFallback(role, func(target modelTarget) error {
+		req.Model = target.model
+		return withRetry(ctx, func(ctx context.Context) error {
+			var err error
+			stream, err = target.provider.CreateChatCompletionStream(ctx, req)
+			return err
+		})
+	})
 	if err != nil {
-		log.Printf("Error calling AI API: %v\n", err)
-		return openai.ChatCompletionMessage{
-			Role:    RoleAssistant,
-			Content: fmt.Sprintf("Sorry, I encountered an error when processing your request: %v", err),
+		return openai.ChatCompletionMessage{}, err
+	}
+	defer stream.Close()
+
+	msg := openai.ChatCompletionMessage{Role: RoleAssistant}
+	var content strings.Builder
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			recordUsage(req.Model, message, nil, content.String())
+			return openai.ChatCompletionMessage{}, classify(ctx, err, 0)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta
+		for _, call := range delta.ToolCalls {
+			mergeToolCall(&msg, call)
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if onDelta != nil && !onDelta(delta.Content) {
+				break
+			}
 		}
 	}
 
-	if len(rsp.Choices) == 0 {
-		log.Println("Error: No response choices received from API")
-		return openai.ChatCompletionMessage{
-			Role:    RoleAssistant,
-			Content: "Sorry, I received an empty response. Please try again.",
+	msg.Content = content.String()
+	// A stream stopped early never receives the usage, so it is estimated
+	recordUsage(req.Model, message, usage, msg.Content)
+	return msg, nil
+}
+
+// mergeToolCall folds a streamed tool call fragment into the message being assembled
+func mergeToolCall(msg *openai.ChatCompletionMessage, fragment openai.ToolCall) {
+	index := len(msg.ToolCalls)
+	if fragment.Index != nil {
+		index = *fragment.Index
+	}
+	for len(msg.ToolCalls) <= index {
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{Type: openai.ToolTypeFunction})
+	}
+
+	call := &msg.ToolCalls[index]
+	if fragment.ID != "" {
+		call.ID = fragment.ID
+	}
+	if fragment.Type != "" {
+		call.Type = fragment.Type
+	}
+	call.Function.Name += fragment.Function.Name
+	call.Function.Arguments += fragment.Function.Arguments
+}
+
+// toolUnsupportedPhrases are the messages of the providers that reject tool definitions, e.g.
+// Ollama's "model does not support tools" or vLLM's "tool choice requires
+// --enable-auto-tool-choice". They are matched in lower case without quotes.
+var toolUnsupportedPhrases = []string{
+	"does not support tools",
+	"does not support tool calling",
+	"does not support function calling",
+	"does not support functions",
+	"tools is not supported",
+	"tools are not supported",
+	"tool calling is not supported",
+	"tool use is not supported",
+	"function calling is not supported",
+	"functions is not supported",
+	"unrecognized request argument supplied: tools",
+	"unrecognized request argument supplied: tool_choice",
+	"unrecognized request argument supplied: functions",
+	"tool choice requires --enable-auto-tool-choice",
+	"tools param requires --jinja",
+}
+
+// IsToolCallingUnsupported reports whether err indicates that the model or endpoint
+// rejected a request because it does not support tools. Only a 400 response with one of
+// the known messages qualifies, other rejections, e.g. invalid tool arguments, an unknown
+// model or an oversized prompt, are real errors.
+func IsToolCallingUnsupported(err error) bool {
+	var status int
+	var msg string
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status, msg = apiErr.HTTPStatusCode, apiErr.Message
+	case errors.As(err, &reqErr):
+		status, msg = reqErr.HTTPStatusCode, string(reqErr.Body)
+		if reqErr.Err != nil {
+			msg += " " + reqErr.Err.Error()
 		}
+	default:
+		return false
 	}
 
-	return rsp.Choices[0].Message
+	if status != http.StatusBadRequest {
+		return false
+	}
+	msg = strings.ToLower(strings.NewReplacer("'", "", `"`, "", "`", "").Replace(msg))
+	for _, phrase := range toolUnsupportedPhrases {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// createChatCompletion performs a chat completion call with the model of the role, retried on
+// transient failures and then with the fallback models, and returns the first choice
+func createChatCompletion(ctx context.Context, role ModelRole, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+	var msg openai.ChatCompletionMessage
+	err := withFallback(role, func(target modelTarget) error {
+		req.Model = target.model
+		return withRetry(ctx, func(ctx context.Context) error {
+			// Every attempt gets its own timeout
+			ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+			defer cancel()
+
+			rsp, err := target.provider.CreateChatCompletion(ctx, req)
+			if err != nil {
+				return err
+			}
+			content := ""
+			if len(rsp.Choices) > 0 {
+				content = rsp.Choices[0].Message.Content
+			}
+			recordUsage(req.Model, req.Messages, &rsp.Usage, content)
+
+			if len(rsp.Choices) == 0 {
+				return ErrEmptyResponse
+			}
+			msg = rsp.Choices[0].Message
+			return nil
+		})
+	})
+	return msg, err
 }
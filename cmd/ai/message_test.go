@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestIsToolCallingUnsupported(t *testing.T) {
+	apiErr := func(status int, msg string) error {
+		return &openai.APIError{HTTPStatusCode: status, Message: msg}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Ollama model without tools", err: apiErr(400, `{"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`), want: true},
+		{name: "quoted parameter", err: apiErr(400, "'tools' is not supported with this model."), want: true},
+		{name: "unrecognized argument", err: apiErr(400, "Unrecognized request argument supplied: tools"), want: true},
+		{name: "vLLM without a tool parser", err: apiErr(400, `"auto" tool choice requires --enable-auto-tool-choice and --tool-call-parser to be set`), want: true},
+		{name: "request error body", err: &openai.RequestError{HTTPStatusCode: 400, Body: []byte(`{"message":"Tool calling is not supported"}`)}, want: true},
+		{name: "wrapped by the retries", err: classify(context.Background(), apiErr(400, "model does not support tools"), 0), want: true},
+		{name: "wrapped with a message", err: fmt.Errorf("chat: %w", apiErr(400, "tools are not supported")), want: true},
+
+		{name: "other status", err: apiErr(404, "model does not support tools")},
+		{name: "server error", err: apiErr(500, "tools is not supported")},
+		{name: "invalid tool arguments", err: apiErr(400, "Invalid arguments for tool ListTool: resource is required")},
+		{name: "function schema typo", err: apiErr(400, "Invalid schema for function 'ListTool': 'strnig' is not valid")},
+		{name: "unknown model", err: apiErr(400, "The model `gpt-9` does not exist")},
+		{name: "oversized prompt", err: apiErr(400, "This model's maximum context length is 8192 tokens")},
+		{name: "not an API error", err: errors.New("does not support tools")},
+		{name: "no error", err: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsToolCallingUnsupported(tt.err); got != tt.want {
+				t.Errorf("IsToolCallingUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
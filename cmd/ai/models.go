@@ -0,0 +1,199 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"kgent/cmd/config"
+	"kgent/cmd/utils"
+)
+
+// ModelRole is the task a model is used for, so each task can use a model that fits it
+type ModelRole string
+
+const (
+	// ModelReasoning drives the agent loop
+	ModelReasoning ModelRole = "reasoning"
+	// ModelYAMLGeneration writes the resource definitions of CreateTool
+	ModelYAMLGeneration ModelRole = "yaml-generation"
+	// ModelSummarization compacts the conversation history
+	ModelSummarization ModelRole = "summarization"
+)
+
+// ModelRoles lists all roles
+var ModelRoles = []ModelRole{ModelReasoning, ModelYAMLGeneration, ModelSummarization}
+
+// ModelsConfig selects the model of each role and the models tried when it fails. Models are
+// given as "model" for the configured provider or "provider:model", e.g. "ollama:qwen2.5:14b".
+type ModelsConfig struct {
+	// Roles maps a role to its model; roles without a model use the provider model
+	Roles map[ModelRole]string
+	// Fallbacks are tried in order when the model of a role is unavailable
+	Fallbacks []string
+}
+
+// modelTarget is a model served by a provider
+type modelTarget struct {
+	provider Provider
+	model    string
+}
+
+// String returns the target as "provider:model"
+func (t modelTarget) String() string {
+	return t.provider.Name() + ":" + t.model
+}
+
+var (
+	// roleTargets is the model of each role
+	roleTargets = map[ModelRole]modelTarget{}
+	// fallbackTargets are tried in order when the model of a role fails
+	fallbackTargets []modelTarget
+)
+
+// OnFallback is called when a model failed and the next model of the fallback list is tried
+var OnFallback func(err error, model string)
+
+// ModelsConfigFromEnv reads the model of each role from KGENT_MODEL_<ROLE>, e.g.
+// KGENT_MODEL_YAML_GENERATION, and the fallback list from the comma separated
+// KGENT_FALLBACK_MODELS
+func ModelsConfigFromEnv() ModelsConfig {
+	cfg := ModelsConfig{Roles: map[ModelRole]string{}}
+	for _, role := range ModelRoles {
+		key := "KGENT_MODEL_" + strings.ToUpper(strings.ReplaceAll(string(role), "-", "_"))
+		if model := utils.GetEnv(key, ""); model != "" {
+			cfg.Roles[role] = model
+		}
+	}
+	for _, model := range strings.Split(utils.GetEnv("KGENT_FALLBACK_MODELS", ""), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			cfg.Fallbacks = append(cfg.Fallbacks, model)
+		}
+	}
+	return cfg
+}
+
+// ConfigureModels routes every role to its model. provider and providerCfg are the configured
+// provider, used for roles without a model and for models given without a provider; the other
+// providers are configured from the environment.
+func ConfigureModels(provider Provider, providerCfg ProviderConfig, cfg ModelsConfig) error {
+	providers := map[string]Provider{provider.Name(): provider}
+
+	resolve := func(spec string) (modelTarget, error) {
+		providerType, model := provider.Name(), spec
+		if name, rest, ok := strings.Cut(spec, ":"); ok && isProviderType(name) {
+			providerType, model = name, rest
+		}
+		if model == "" {
+			return modelTarget{}, fmt.Errorf("invalid model %q", spec)
+		}
+
+		p, ok := providers[providerType]
+		if !ok {
+			var err error
+			if p, err = NewProvider(providerConfigFromEnv(providerType, config.Profile{})); err != nil {
+				return modelTarget{}, fmt.Errorf("model %s: %w", spec, err)
+			}
+			providers[providerType] = p
+		}
+		return modelTarget{provider: p, model: model}, nil
+	}
+
+	targets := map[ModelRole]modelTarget{}
+	for _, role := range ModelRoles {
+		spec, ok := cfg.Roles[role]
+		if !ok {
+			targets[role] = modelTarget{provider: provider, model: providerCfg.Model}
+			continue
+		}
+		target, err := resolve(spec)
+		if err != nil {
+			return fmt.Errorf("%s model: %w", role, err)
+		}
+		targets[role] = target
+	}
+
+	var fallbacks []modelTarget
+	for _, spec := range cfg.Fallbacks {
+		target, err := resolve(spec)
+		if err != nil {
+			return fmt.Errorf("fallback model: %w", err)
+		}
+		fallbacks = append(fallbacks, target)
+	}
+
+	roleTargets = targets
+	fallbackTargets = fallbacks
+	ModelName = targets[ModelReasoning].model
+	return nil
+}
+
+// ModelFor returns the model used for a role as "provider:model"
+func ModelFor(role ModelRole) string {
+	return roleTargets[role].String()
+}
+
+// Ping sends a minimal request to the model of the role, without retries or fallback, to
+// check the credentials and that the model API can be reached
+func Ping(ctx context.Context, role ModelRole) error {
+	target, ok := roleTargets[role]
+	if !ok {
+		return fmt.Errorf("no model is configured for %s", role)
+	}
+	_, err := target.provider.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     target.model,
+		MaxTokens: 1,
+		Messages:  []openai.ChatCompletionMessage{{Role: RoleUser, Content: "ping"}},
+	})
+	return classify(ctx, err, 0)
+}
+
+// targetsFor returns the model of the role followed by the fallback models
+func targetsFor(role ModelRole) []modelTarget {
+	targets := []modelTarget{roleTargets[role]}
+	for _, fallback := range fallbackTargets {
+		if fallback != targets[0] {
+			targets = append(targets, fallback)
+		}
+	}
+	return targets
+}
+
+// withFallback calls fn with the model of the role and then with each fallback model, until
+// a call succeeds or fails in a way another model would not fix
+func withFallback(role ModelRole, fn func(target modelTarget) error) error {
+	targets := targetsFor(role)
+	var err error
+	for i, target := range targets {
+		if err = fn(target); err == nil || !shouldFallBack(err) {
+			return err
+		}
+		if i+1 < len(targets) && OnFallback != nil {
+			OnFallback(err, targets[i+1].String())
+		}
+	}
+	return err
+}
+
+// shouldFallBack reports whether another model may succeed where the call failed. Requests
+// rejected as invalid are not retried with another model, except when the model was not found.
+func shouldFallBack(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Kind != ErrRejected || apiErr.StatusCode == 404
+}
+
+// isProviderType reports whether name is a known provider type
+func isProviderType(name string) bool {
+	switch name {
+	case ProviderOpenAI, ProviderAzure, ProviderOllama, ProviderAnthropic:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,244 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ollamaProvider talks to the native chat API of Ollama
+type ollamaProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// ollamaMessage is a message of the Ollama chat API
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall is a tool call of the Ollama chat API, whose arguments are a JSON object
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaRequest is the body of /api/chat
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Tools    []openai.Tool          `json:"tools,omitempty"`
+	Stream   bool                   `json:"stream"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaResponse is a response, or a chunk of a streamed response, of /api/chat
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// newOllamaProvider creates a provider for an Ollama server
+func newOllamaProvider(cfg ProviderConfig) *ollamaProvider {
+	return &ollamaProvider{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		client:  newHTTPClient(),
+	}
+}
+
+// Name returns the provider type
+func (p *ollamaProvider) Name() string {
+	return ProviderOllama
+}
+
+// CreateChatCompletion performs a chat completion call
+func (p *ollamaProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	rsp, err := postJSON(ctx, p.client, p.baseURL+"/api/chat", nil, newOllamaRequest(req, false))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer rsp.Body.Close()
+
+	var body ollamaResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if body.Error != "" {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("ollama: %s", body.Error)
+	}
+
+	toolCalls := body.Message.openAIToolCalls(0)
+	return openai.ChatCompletionResponse{
+		Model: body.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:      RoleAssistant,
+				Content:   body.Message.Content,
+				ToolCalls: toolCalls,
+			},
+			FinishReason: ollamaFinishReason(body.DoneReason, len(toolCalls) > 0),
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     body.PromptEvalCount,
+			CompletionTokens: body.EvalCount,
+			TotalTokens:      body.PromptEvalCount + body.EvalCount,
+		},
+	}, nil
+}
+
+// CreateChatCompletionStream performs a streamed chat completion call
+func (p *ollamaProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (CompletionStream, error) {
+	rsp, err := postJSON(ctx, p.client, p.baseURL+"/api/chat", nil, newOllamaRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaStream{body: rsp.Body, reader: bufio.NewReader(rsp.Body)}, nil
+}
+
+// newOllamaRequest translates an OpenAI request to the Ollama chat API
+func newOllamaRequest(req openai.ChatCompletionRequest, stream bool) ollamaRequest {
+	out := ollamaRequest{
+		Model:  req.Model,
+		Tools:  req.Tools,
+		Stream: stream,
+	}
+	if len(req.Stop) > 0 {
+		out.Options = map[string]interface{}{"stop": req.Stop}
+	}
+
+	for _, msg := range req.Messages {
+		m := ollamaMessage{Role: msg.Role, Content: msg.Content, ToolName: msg.Name}
+		for _, call := range msg.ToolCalls {
+			var c ollamaToolCall
+			c.Function.Name = call.Function.Name
+			c.Function.Arguments = jsonObject(call.Function.Arguments)
+			m.ToolCalls = append(m.ToolCalls, c)
+		}
+		out.Messages = append(out.Messages, m)
+	}
+	return out
+}
+
+// ollamaFinishReason maps the done reason of a response to the OpenAI finish reason
+func ollamaFinishReason(doneReason string, toolCalls bool) openai.FinishReason {
+	switch {
+	case toolCalls:
+		return openai.FinishReasonToolCalls
+	case doneReason == "length":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// openAIToolCalls converts the tool calls of the message, indexed from offset. Ollama does
+// not give them IDs, so random IDs are generated to keep them unique in the whole history.
+func (m ollamaMessage) openAIToolCalls(offset int) []openai.ToolCall {
+	var calls []openai.ToolCall
+	for i, call := range m.ToolCalls {
+		index := offset + i
+		calls = append(calls, openai.ToolCall{
+			Index: &index,
+			ID:    newToolCallID(),
+			Type:  openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			},
+		})
+	}
+	return calls
+}
+
+// ollamaStream reads the newline delimited JSON chunks of a streamed response
+type ollamaStream struct {
+	body      io.ReadCloser
+	reader    *bufio.Reader
+	toolCalls int
+	done      bool
+}
+
+// Recv returns the next chunk of the response
+func (s *ollamaStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		if s.done {
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) == 0 {
+			if err != nil {
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			continue
+		}
+
+		var chunk ollamaResponse
+		if jsonErr := json.Unmarshal(line, &chunk); jsonErr != nil {
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("failed to decode ollama stream: %w", jsonErr)
+		}
+		if chunk.Error != "" {
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+
+		out := openai.ChatCompletionStreamResponse{
+			Model: chunk.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta: openai.ChatCompletionStreamChoiceDelta{
+					Content:   chunk.Message.Content,
+					ToolCalls: chunk.Message.openAIToolCalls(s.toolCalls),
+				},
+			}},
+		}
+		s.toolCalls += len(chunk.Message.ToolCalls)
+
+		if chunk.Done {
+			s.done = true
+			out.Choices[0].FinishReason = ollamaFinishReason(chunk.DoneReason, s.toolCalls > 0)
+			out.Usage = &openai.Usage{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+				TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+			}
+		}
+		return out, nil
+	}
+}
+
+// Close releases the connection
+func (s *ollamaStream) Close() error {
+	return s.body.Close()
+}
+
+// newToolCallID returns a random ID for a tool call
+func newToolCallID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
+
+// jsonObject returns arguments as a JSON object, or an empty object if they are not valid JSON
+func jsonObject(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
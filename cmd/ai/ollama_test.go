@@ -0,0 +1,168 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TestOllamaToolCallIDs checks that the generated IDs stay unique across the responses of a
+// conversation
+func TestOllamaToolCallIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[
+			{"function":{"name":"ListTool","arguments":{"resource":"pod"}}},
+			{"function":{"name":"ListTool","arguments":{"resource":"service"}}}]},"done":true}`)
+	}))
+	defer server.Close()
+
+	p := newOllamaProvider(ProviderConfig{BaseURL: server.URL})
+	seen := map[string]bool{}
+	for round := 0; round < 2; round++ {
+		rsp, err := p.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{Model: "llama3"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, call := range rsp.Choices[0].Message.ToolCalls {
+			if call.ID == "" || seen[call.ID] {
+				t.Errorf("round %d: tool call ID %q is empty or reused", round+1, call.ID)
+			}
+			seen[call.ID] = true
+		}
+	}
+	if len(seen) != 4 {
+		t.Errorf("got %d distinct IDs, want 4", len(seen))
+	}
+}
+
+func TestOllama(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []openai.ChatCompletionMessage
+		tools    []openai.Tool
+		stop     []string
+		stream   bool
+		reply    string
+		// wantRequest is the request without the model and the tools
+		wantRequest string
+		// want has the tool calls without their generated IDs
+		want    exchange
+		wantErr string
+	}{
+		{
+			name:        "text answer",
+			messages:    []openai.ChatCompletionMessage{{Role: RoleSystem, Content: "You are a Kubernetes expert."}, {Role: RoleUser, Content: "list the pods"}},
+			stop:        []string{"Observation:"},
+			reply:       `{"model":"llama3","message":{"role":"assistant","content":"Final Answer: none"},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":4}`,
+			wantRequest: `{"messages":[{"role":"system","content":"You are a Kubernetes expert."},{"role":"user","content":"list the pods"}],"stream":false,"options":{"stop":["Observation:"]}}`,
+			want:        exchange{content: "Final Answer: none", finish: openai.FinishReasonStop, usage: openai.Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}},
+		},
+		{
+			name:     "tool call round trip",
+			messages: toolRoundTrip,
+			tools:    []openai.Tool{listTool},
+			reply:    `{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"ListTool","arguments":{"resource":"service"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":40,"eval_count":10}`,
+			wantRequest: `{"messages":[{"role":"system","content":"You are a Kubernetes expert."},{"role":"user","content":"list the pods"},` +
+				`{"role":"assistant","content":"","tool_calls":[{"function":{"name":"ListTool","arguments":{"resource":"pod"}}}]},` +
+				`{"role":"tool","content":"[\"web\"]","tool_name":"ListTool"}],"stream":false}`,
+			want: exchange{calls: []string{`ListTool {"resource":"service"}`}, finish: openai.FinishReasonToolCalls, usage: openai.Usage{PromptTokens: 40, CompletionTokens: 10, TotalTokens: 50}},
+		},
+		{
+			name:     "streamed tool call",
+			messages: toolRoundTrip,
+			tools:    []openai.Tool{listTool},
+			stream:   true,
+			reply: `{"model":"llama3","message":{"role":"assistant","content":"Checking "},"done":false}` + "\n" +
+				`{"model":"llama3","message":{"role":"assistant","content":"the services."},"done":false}` + "\n\n" +
+				`{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"ListTool","arguments":{"resource":"service"}}},{"function":{"name":"GetTool","arguments":{"resource":"service","name":"web"}}}]},"done":false}` + "\n" +
+				`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":40,"eval_count":25}` + "\n",
+			wantRequest: `{"messages":[{"role":"system","content":"You are a Kubernetes expert."},{"role":"user","content":"list the pods"},` +
+				`{"role":"assistant","content":"","tool_calls":[{"function":{"name":"ListTool","arguments":{"resource":"pod"}}}]},` +
+				`{"role":"tool","content":"[\"web\"]","tool_name":"ListTool"}],"stream":true}`,
+			want: exchange{
+				content: "Checking the services.",
+				calls:   []string{`ListTool {"resource":"service"}`, `GetTool {"resource":"service","name":"web"}`},
+				finish:  openai.FinishReasonToolCalls,
+				usage:   openai.Usage{PromptTokens: 40, CompletionTokens: 25, TotalTokens: 65},
+			},
+		},
+		{
+			name:     "streamed text cut by the token limit",
+			messages: []openai.ChatCompletionMessage{{Role: RoleUser, Content: "explain pods"}},
+			stream:   true,
+			reply: `{"model":"llama3","message":{"role":"assistant","content":"A pod is"},"done":false}` + "\n" +
+				`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":5,"eval_count":3}`,
+			wantRequest: `{"messages":[{"role":"user","content":"explain pods"}],"stream":true}`,
+			want:        exchange{content: "A pod is", finish: openai.FinishReasonLength, usage: openai.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8}},
+		},
+		{
+			name:        "error in the stream",
+			messages:    []openai.ChatCompletionMessage{{Role: RoleUser, Content: "hello"}},
+			stream:      true,
+			reply:       `{"error":"model requires more system memory"}` + "\n",
+			wantRequest: `{"messages":[{"role":"user","content":"hello"}],"stream":true}`,
+			wantErr:     "ollama: model requires more system memory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newProviderServer(t, "application/x-ndjson", tt.reply)
+			p := newOllamaProvider(ProviderConfig{BaseURL: server.URL + "/"})
+
+			got, err := complete(t, p, openai.ChatCompletionRequest{Model: "llama3", Messages: tt.messages, Tools: tt.tools, Stop: tt.stop}, tt.stream)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %s", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				for i, call := range got.calls {
+					id, rest, _ := strings.Cut(call, " ")
+					if !strings.HasPrefix(id, "call_") {
+						t.Errorf("tool call %d has the ID %q", i, id)
+					}
+					got.calls[i] = rest
+				}
+				checkExchange(t, got, tt.want)
+			}
+
+			if server.path != "/api/chat" {
+				t.Errorf("request to %s", server.path)
+			}
+			var req map[string]interface{}
+			if err := json.Unmarshal([]byte(server.request), &req); err != nil {
+				t.Fatal(err)
+			}
+			if req["model"] != "llama3" {
+				t.Errorf("model = %v, want llama3", req["model"])
+			}
+			tools, _ := json.Marshal(req["tools"])
+			if wantTools, _ := json.Marshal(tt.tools); len(tt.tools) > 0 && !jsonEqual(string(tools), string(wantTools)) {
+				t.Errorf("tools = %s\nwant %s", tools, wantTools)
+			}
+			delete(req, "model")
+			delete(req, "tools")
+			if data, _ := json.Marshal(req); !jsonEqual(string(data), tt.wantRequest) {
+				t.Errorf("request = %s\nwant %s", data, tt.wantRequest)
+			}
+		})
+	}
+}
+
+// jsonEqual reports whether two JSON documents have the same content
+func jsonEqual(a string, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
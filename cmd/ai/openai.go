@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// openAIProvider talks to OpenAI compatible endpoints such as DashScope, vLLM or OpenAI itself,
+// and to Azure OpenAI
+type openAIProvider struct {
+	name   string
+	client *openai.Client
+}
+
+// newOpenAIProvider creates a provider for an OpenAI compatible endpoint
+func newOpenAIProvider(cfg ProviderConfig) *openAIProvider {
+	config := openai.DefaultConfig(cfg.APIKey)
+	config.BaseURL = cfg.BaseURL
+	config.HTTPClient = newHTTPClient()
+
+	return &openAIProvider{name: ProviderOpenAI, client: openai.NewClientWithConfig(config)}
+}
+
+// newAzureProvider creates a provider for an Azure OpenAI deployment
+func newAzureProvider(cfg ProviderConfig) *openAIProvider {
+	config := openai.DefaultAzureConfig(cfg.APIKey, cfg.BaseURL)
+	config.APIVersion = cfg.APIVersion
+	config.HTTPClient = newHTTPClient()
+	// Azure serves models through deployments: the configured model goes to the configured
+	// deployment, other models, e.g. of the fallback list, are taken as deployment names
+	config.AzureModelMapperFunc = func(model string) string {
+		if model == cfg.Model {
+			return cfg.Deployment
+		}
+		return model
+	}
+
+	return &openAIProvider{name: ProviderAzure, client: openai.NewClientWithConfig(config)}
+}
+
+// Name returns the provider type
+func (p *openAIProvider) Name() string {
+	return p.name
+}
+
+// CreateChatCompletion performs a chat completion call
+func (p *openAIProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream performs a streamed chat completion call
+func (p *openAIProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (CompletionStream, error) {
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
@@ -0,0 +1,159 @@
+package ai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"kgent/cmd/config"
+	"kgent/cmd/utils"
+)
+
+// Provider types that can be selected with KGENT_PROVIDER
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAzure     = "azure"
+	ProviderOllama    = "ollama"
+	ProviderAnthropic = "anthropic"
+)
+
+// Provider sends chat completion requests to a model vendor. Requests and responses use the
+// OpenAI types, providers with another API translate them, so the rest of kgent does not
+// depend on the vendor. Failed HTTP calls are reported as *openai.APIError with the status code.
+type Provider interface {
+	// Name returns the provider type
+	Name() string
+	// CreateChatCompletion performs a chat completion call
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// CreateChatCompletionStream performs a streamed chat completion call
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (CompletionStream, error)
+}
+
+// CompletionStream returns the chunks of a streamed completion until io.EOF
+type CompletionStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// ProviderConfig selects and configures the provider of the model
+type ProviderConfig struct {
+	// Type is one of ProviderOpenAI, ProviderAzure, ProviderOllama or ProviderAnthropic
+	Type    string
+	APIKey  string
+	BaseURL string
+	Model   string
+	// Deployment is the Azure OpenAI deployment serving the model
+	Deployment string
+	// APIVersion is the Azure OpenAI api-version
+	APIVersion string
+}
+
+// ProviderConfigFromEnv reads the provider configuration from the environment, falling back
+// to the settings of the profile. The openai provider keeps using the DASH_SCOPE_* variables,
+// so existing setups keep working.
+func ProviderConfigFromEnv(profile config.Profile) ProviderConfig {
+	providerType := strings.ToLower(utils.GetEnv("KGENT_PROVIDER", cmp.Or(profile.Provider, ProviderOpenAI)))
+	// The model settings of the profile belong to its provider
+	if providerType != strings.ToLower(cmp.Or(profile.Provider, ProviderOpenAI)) {
+		profile = config.Profile{}
+	}
+	cfg := providerConfigFromEnv(providerType, profile)
+
+	// KGENT_MODEL overrides the model of any provider
+	cfg.Model = utils.GetEnv("KGENT_MODEL", cfg.Model)
+	return cfg
+}
+
+// providerConfigFromEnv reads the configuration of the given provider type from the
+// environment, falling back to the settings of the profile and then to the defaults
+func providerConfigFromEnv(providerType string, profile config.Profile) ProviderConfig {
+	cfg := ProviderConfig{Type: providerType}
+
+	switch cfg.Type {
+	case ProviderAzure:
+		cfg.APIKey = utils.GetEnv("AZURE_OPENAI_API_KEY", profile.APIKey)
+		cfg.BaseURL = utils.GetEnv("AZURE_OPENAI_ENDPOINT", profile.Endpoint)
+		cfg.Deployment = utils.GetEnv("AZURE_OPENAI_DEPLOYMENT", "")
+		cfg.APIVersion = utils.GetEnv("AZURE_OPENAI_API_VERSION", "2024-06-01")
+		cfg.Model = utils.GetEnv("AZURE_OPENAI_MODEL", cmp.Or(profile.Model, cfg.Deployment))
+	case ProviderOllama:
+		cfg.BaseURL = utils.GetEnv("OLLAMA_HOST", cmp.Or(profile.Endpoint, "http://localhost:11434"))
+		cfg.Model = utils.GetEnv("OLLAMA_MODEL", cmp.Or(profile.Model, "llama3.1"))
+	case ProviderAnthropic:
+		cfg.APIKey = utils.GetEnv("ANTHROPIC_API_KEY", profile.APIKey)
+		cfg.BaseURL = utils.GetEnv("ANTHROPIC_BASE_URL", cmp.Or(profile.Endpoint, "https://api.anthropic.com"))
+		cfg.Model = utils.GetEnv("ANTHROPIC_MODEL", cmp.Or(profile.Model, "claude-3-5-sonnet-latest"))
+	default:
+		cfg.APIKey = utils.GetEnv("DASH_SCOPE_API_KEY", profile.APIKey)
+		cfg.BaseURL = utils.GetEnv("DASH_SCOPE_URL", cmp.Or(profile.Endpoint, "https://dashscope.aliyuncs.com/compatible-mode/v1"))
+		cfg.Model = utils.GetEnv("DASH_SCOPE_MODEL", cmp.Or(profile.Model, "qwen-max"))
+	}
+	return cfg
+}
+
+// NewProvider creates the provider described by cfg
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Type {
+	case ProviderOpenAI, "":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("DASH_SCOPE_API_KEY is not set. Please set this environment variable")
+		}
+		return newOpenAIProvider(cfg), nil
+	case ProviderAzure:
+		if cfg.APIKey == "" || cfg.BaseURL == "" || cfg.Deployment == "" {
+			return nil, fmt.Errorf("the azure provider needs AZURE_OPENAI_API_KEY, AZURE_OPENAI_ENDPOINT and AZURE_OPENAI_DEPLOYMENT")
+		}
+		return newAzureProvider(cfg), nil
+	case ProviderOllama:
+		return newOllamaProvider(cfg), nil
+	case ProviderAnthropic:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is not set. Please set this environment variable")
+		}
+		return newAnthropicProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q, use one of %s, %s, %s or %s",
+			cfg.Type, ProviderOpenAI, ProviderAzure, ProviderOllama, ProviderAnthropic)
+	}
+}
+
+// postJSON sends body to url and returns the response of a successful call. Other status
+// codes are returned as *openai.APIError so callers handle every provider the same way.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return rsp, nil
+	}
+
+	defer rsp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 4096))
+	return nil, &openai.APIError{
+		Message:        strings.TrimSpace(string(msg)),
+		HTTPStatus:     rsp.Status,
+		HTTPStatusCode: rsp.StatusCode,
+	}
+}
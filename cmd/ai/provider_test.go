@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// providerServer replies to every request with a canned body and keeps the last request
+type providerServer struct {
+	*httptest.Server
+	path    string
+	header  http.Header
+	request string
+}
+
+func newProviderServer(t *testing.T, contentType string, reply string) *providerServer {
+	t.Helper()
+	s := &providerServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.path, s.header, s.request = r.URL.Path, r.Header.Clone(), string(body)
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// exchange is the result of a completion call, streamed or not
+type exchange struct {
+	content string
+	// calls are the tool calls as "id name arguments"
+	calls  []string
+	finish openai.FinishReason
+	usage  openai.Usage
+}
+
+// complete sends req to the provider, as a stream if stream is set, and folds the response
+// the way ChatStream does
+func complete(t *testing.T, p Provider, req openai.ChatCompletionRequest, stream bool) (exchange, error) {
+	t.Helper()
+	var msg openai.ChatCompletionMessage
+	var got exchange
+	if !stream {
+		rsp, err := p.CreateChatCompletion(context.Background(), req)
+		if err != nil {
+			return got, err
+		}
+		msg, got.finish, got.usage = rsp.Choices[0].Message, rsp.Choices[0].FinishReason, rsp.Usage
+	} else {
+		s, err := p.CreateChatCompletionStream(context.Background(), req)
+		if err != nil {
+			return got, err
+		}
+		defer s.Close()
+		for {
+			chunk, err := s.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return got, err
+			}
+			if chunk.Usage != nil {
+				got.usage = *chunk.Usage
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			msg.Content += chunk.Choices[0].Delta.Content
+			for _, call := range chunk.Choices[0].Delta.ToolCalls {
+				mergeToolCall(&msg, call)
+			}
+			if reason := chunk.Choices[0].FinishReason; reason != "" {
+				got.finish = reason
+			}
+		}
+	}
+
+	got.content = msg.Content
+	for _, call := range msg.ToolCalls {
+		got.calls = append(got.calls, call.ID+" "+call.Function.Name+" "+call.Function.Arguments)
+	}
+	return got, nil
+}
+
+// checkExchange compares a response with the expected one
+func checkExchange(t *testing.T, got exchange, want exchange) {
+	t.Helper()
+	if got.content != want.content {
+		t.Errorf("content = %q, want %q", got.content, want.content)
+	}
+	if strings.Join(got.calls, "\n") != strings.Join(want.calls, "\n") {
+		t.Errorf("tool calls = %q, want %q", got.calls, want.calls)
+	}
+	if got.finish != want.finish {
+		t.Errorf("finish reason = %q, want %q", got.finish, want.finish)
+	}
+	if got.usage != want.usage {
+		t.Errorf("usage = %+v, want %+v", got.usage, want.usage)
+	}
+}
+
+// toolRoundTrip is a conversation in which the model called ListTool and got its result
+var toolRoundTrip = []openai.ChatCompletionMessage{
+	{Role: RoleSystem, Content: "You are a Kubernetes expert."},
+	{Role: RoleUser, Content: "list the pods"},
+	{Role: RoleAssistant, ToolCalls: []openai.ToolCall{{
+		ID: "call_1", Type: openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "ListTool", Arguments: `{"resource":"pod"}`},
+	}}},
+	{Role: RoleTool, ToolCallID: "call_1", Name: "ListTool", Content: `["web"]`},
+}
+
+// listTool is the definition of ListTool sent with the requests
+var listTool = openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+	Name:        "ListTool",
+	Description: "Lists resources",
+	Parameters:  map[string]interface{}{"type": "object"},
+}}
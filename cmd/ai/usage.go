@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"kgent/cmd/utils"
+)
+
+// Usage counts the tokens consumed by calls to the AI API
+type Usage struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	// EstimatedCalls is the number of calls whose usage was not reported by the API and
+	// had to be estimated, e.g. streams that were stopped early
+	EstimatedCalls int `json:"estimatedCalls,omitempty"`
+	// Cost is in the currency of the price table; calls to models without a price cost nothing
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// TotalTokens returns the number of prompt and completion tokens
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Calls:            u.Calls + other.Calls,
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		EstimatedCalls:   u.EstimatedCalls + other.EstimatedCalls,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+// Sub returns the usage consumed since an earlier snapshot
+func (u Usage) Sub(earlier Usage) Usage {
+	return Usage{
+		Calls:            u.Calls - earlier.Calls,
+		PromptTokens:     u.PromptTokens - earlier.PromptTokens,
+		CompletionTokens: u.CompletionTokens - earlier.CompletionTokens,
+		EstimatedCalls:   u.EstimatedCalls - earlier.EstimatedCalls,
+		Cost:             u.Cost - earlier.Cost,
+	}
+}
+
+// String summarizes the usage on a single line
+func (u Usage) String() string {
+	s := fmt.Sprintf("%d tokens (prompt %d, completion %d) in %d calls",
+		u.TotalTokens(), u.PromptTokens, u.CompletionTokens, u.Calls)
+	if u.Cost > 0 {
+		s += fmt.Sprintf(", cost %.4f", u.Cost)
+	}
+	if u.EstimatedCalls > 0 {
+		s += fmt.Sprintf(", %d calls estimated", u.EstimatedCalls)
+	}
+	return s
+}
+
+// Price is the cost of a model per million tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Prices maps model names to their price. Models without a price are not billed.
+var Prices = map[string]Price{}
+
+var (
+	usageMu    sync.Mutex
+	totalUsage Usage
+)
+
+// TotalUsage returns the usage of every call made by the process so far. Take a snapshot
+// before an operation and Sub it afterwards to get the usage of the operation.
+func TotalUsage() Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	return totalUsage
+}
+
+// PricesFile returns the location of the price table, set with KGENT_PRICES
+func PricesFile() string {
+	if file := utils.GetEnv("KGENT_PRICES", ""); file != "" {
+		return file
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "kgent", "prices.json")
+}
+
+// LoadPrices reads a price table such as {"qwen-max": {"prompt": 2.4, "completion": 9.6}}.
+// A missing file leaves the table empty.
+func LoadPrices(file string) error {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	prices := map[string]Price{}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("failed to parse price table %s: %w", file, err)
+	}
+	Prices = prices
+	return nil
+}
+
+// recordUsage adds a call to the total usage. When the API did not report the usage it is
+// estimated from the request messages and the response content.
+func recordUsage(model string, messages []openai.ChatCompletionMessage, reported *openai.Usage, content string) {
+	call := Usage{Calls: 1}
+	if reported != nil && reported.TotalTokens > 0 {
+		call.PromptTokens = reported.PromptTokens
+		call.CompletionTokens = reported.CompletionTokens
+	} else {
+		for _, msg := range messages {
+			call.PromptTokens += EstimateMessageTokens(msg)
+		}
+		call.CompletionTokens = EstimateTokens(content)
+		call.EstimatedCalls = 1
+	}
+
+	if price, ok := Prices[model]; ok {
+		call.Cost = (float64(call.PromptTokens)*price.Prompt + float64(call.CompletionTokens)*price.Completion) / 1e6
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	totalUsage = totalUsage.Add(call)
+}
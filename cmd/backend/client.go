@@ -0,0 +1,383 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kgent/cmd/cassette"
+	"kgent/cmd/config"
+)
+
+// Kinds of errors of the Kgent API, match them with errors.Is
+var (
+	ErrBadRequest      = errors.New("the Kgent API rejected the request")
+	ErrUnauthorized    = errors.New("the Kgent API rejected the credentials")
+	ErrForbidden       = errors.New("the Kgent API denied the request")
+	ErrNotFound        = errors.New("the resource was not found")
+	ErrConflict        = errors.New("the resource already exists")
+	ErrServer          = errors.New("the Kgent API failed")
+	ErrUnreachable     = errors.New("the Kgent API could not be reached")
+	ErrInvalidResponse = errors.New("the Kgent API returned an invalid response")
+)
+
+// maxErrorBody limits how much of a response body is kept in an error
+const maxErrorBody = 4096
+
+// Error is a failed call to the Kgent API
+type Error struct {
+	// Kind is one of the Err* variables
+	Kind error
+	// StatusCode is the HTTP status of the response, if any
+	StatusCode int
+	// Method and URL describe the request
+	Method string
+	URL    string
+	// Message is the error reported by the API, or the underlying error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	var s strings.Builder
+	s.WriteString(e.Kind.Error())
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&s, " (HTTP %d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&s, ": %s", e.Message)
+	} else if e.Err != nil {
+		fmt.Fprintf(&s, ": %v", e.Err)
+	}
+	return s.String()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// envelope is the body of every response of the Kgent API
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+}
+
+// Client calls the resources endpoint of the Kgent API
+type Client struct {
+	baseURL    string
+	cluster    string
+	timeout    time.Duration
+	auth       config.BackendAuth
+	httpClient *http.Client
+}
+
+// New creates a client of the resources endpoint at baseURL, e.g.
+// http://localhost:8000/api/v1/resources. cluster is sent with every request if set, and
+// every request is aborted after timeout if it is positive. The credentials of auth are sent with every request.
+func New(baseURL string, cluster string, timeout time.Duration, auth config.BackendAuth) (*Client, error) {
+	transport, err := newTransport(auth)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		cluster:    cluster,
+		timeout:    timeout,
+		auth:       auth,
+		httpClient: &http.Client{Transport: cassette.Transport(transport)},
+	}, nil
+}
+
+// Clients of the Kgent API by configuration, kept so every tool call reuses the connections
+// and the TLS settings
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*Client{}
+)
+
+// FromConfig returns the client of the Kgent API of the active configuration, working on the
+// cluster of the selected kubeconfig context
+func FromConfig() (*Client, error) {
+	cfg := config.Active
+	key := fmt.Sprintf("%s|%s|%s|%v", cfg.BackendURL, cfg.KubeContext, cfg.BackendTimeout, cfg.BackendAuth)
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[key]; ok {
+		return c, nil
+	}
+	c, err := New(cfg.BackendURL, cfg.KubeContext, cfg.BackendTimeout, cfg.BackendAuth)
+	if err != nil {
+		return nil, err
+	}
+	clients[key] = c
+	return c, nil
+}
+
+// Transports of the Kgent API by CA bundle, client certificate and key, so the files are
+// loaded once and the connections are shared by the clients of every context
+var (
+	transportsMu sync.Mutex
+	transports   = map[[3]string]http.RoundTripper{}
+)
+
+// newTransport returns the default transport, with the CA bundle and the client certificate
+// of auth if set
+func newTransport(auth config.BackendAuth) (http.RoundTripper, error) {
+	if (auth.CertFile == "") != (auth.KeyFile == "") {
+		return nil, errors.New("the client certificate of the Kgent API needs both a certificate and a key file, set cert_file and key_file (KGENT_API_CERT_FILE and KGENT_API_KEY_FILE) together")
+	}
+	if auth.CAFile == "" && auth.CertFile == "" {
+		return http.DefaultTransport, nil
+	}
+
+	key := [3]string{auth.CAFile, auth.CertFile, auth.KeyFile}
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if transport, ok := transports[key]; ok {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if auth.CAFile != "" {
+		pem, err := os.ReadFile(auth.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle of the Kgent API: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle %s", auth.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if auth.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate of the Kgent API: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transports[key] = transport
+	return transport, nil
+}
+
+// List returns the resources of a type in a namespace
+func (c *Client) List(ctx context.Context, resource string, namespace string) (string, error) {
+	return c.do(ctx, http.MethodGet, resourcePath(resource), url.Values{"ns": {namespace}}, nil)
+}
+
+// Create submits a resource definition in YAML, created in namespace if it has none
+func (c *Client) Create(ctx context.Context, resource string, namespace string, yaml string) (string, error) {
+	return c.do(ctx, http.MethodPost, resourcePath(resource), url.Values{"ns": {namespace}}, map[string]string{"yaml": yaml})
+}
+
+// Delete removes a resource by name
+func (c *Client) Delete(ctx context.Context, resource string, namespace string, name string) (string, error) {
+	return c.do(ctx, http.MethodDelete, resourcePath(resource), url.Values{"ns": {namespace}, "name": {name}}, nil)
+}
+
+// Get returns a resource by name as YAML or JSON
+func (c *Client) Get(ctx context.Context, resource string, namespace string, name string, format string) (string, error) {
+	return c.do(ctx, http.MethodGet, resourcePath(resource, name), url.Values{"ns": {namespace}, "format": {format}}, nil)
+}
+
+// Describe returns a resource by name with its conditions, owners and recent events
+func (c *Client) Describe(ctx context.Context, resource string, namespace string, name string) (string, error) {
+	return c.do(ctx, http.MethodGet, resourcePath(resource, name)+"/describe", url.Values{"ns": {namespace}}, nil)
+}
+
+// resourcePath returns the escaped path of a resource type, or of a resource by name
+func resourcePath(resource string, name ...string) string {
+	path := url.PathEscape(strings.ToLower(resource))
+	for _, n := range name {
+		path += "/" + url.PathEscape(n)
+	}
+	return path
+}
+
+// HealthURL returns the health endpoint, /health on the host of the base URL
+func (c *Client) HealthURL() string {
+	u, err := url.Parse(c.baseURL)
+	if err != nil || u.Host == "" {
+		return c.baseURL
+	}
+	return u.Scheme + "://" + u.Host + "/health"
+}
+
+// Health returns an error if the health endpoint cannot be reached or does not answer with
+// a success status
+func (c *Client) Health(ctx context.Context) error {
+	rsp, err := c.send(ctx, http.MethodGet, c.HealthURL(), nil)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	return nil
+}
+
+// do calls the endpoint at the escaped path below the base URL and returns the data of the
+// response envelope. JSON strings are returned unquoted, other values as JSON.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}) (string, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.cluster != "" {
+		query.Set("cluster", c.cluster)
+	}
+	endpoint := c.baseURL + "/" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+
+	rsp, err := c.send(ctx, method, endpoint, data)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+
+	var env envelope
+	// An empty body, e.g. of 204 No Content, has no data
+	if err := json.NewDecoder(rsp.Body).Decode(&env); err != nil && err != io.EOF {
+		return "", &Error{Kind: ErrInvalidResponse, Method: method, URL: endpoint, Err: err}
+	}
+	if env.Error != "" {
+		return "", &Error{Kind: ErrServer, Method: method, URL: endpoint, Message: env.Error}
+	}
+	return decodeData(env.Data), nil
+}
+
+// send performs a request and returns the response of a successful call. Other status codes
+// are returned as *Error with the message of the body.
+func (c *Client) send(ctx context.Context, method string, endpoint string, body []byte) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range c.auth.Headers {
+		req.Header.Set(name, value)
+	}
+	if c.auth.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.auth.Token)
+	} else if c.auth.Username != "" {
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		// Cancellation by the caller is not a failure of the API
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		return nil, &Error{Kind: ErrUnreachable, Method: method, URL: endpoint, Err: err}
+	}
+	// The timeout covers reading the body, so it is released with the body
+	rsp.Body = cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return rsp, nil
+	}
+
+	defer rsp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(rsp.Body, maxErrorBody))
+	return nil, &Error{
+		Kind:       kindOf(rsp.StatusCode),
+		StatusCode: rsp.StatusCode,
+		Method:     method,
+		URL:        endpoint,
+		Message:    errorMessage(msg),
+	}
+}
+
+// kindOf maps an HTTP status code to the kind of error
+func kindOf(status int) error {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case status == http.StatusForbidden:
+		return ErrForbidden
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusConflict:
+		return ErrConflict
+	case status >= 500:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
+
+// errorMessage returns the error of an envelope, or the body itself if it is not one
+func errorMessage(body []byte) string {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err == nil && env.Error != "" {
+		return env.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// decodeData returns the data of an envelope as text
+func decodeData(data json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// cancelBody releases the timeout of a request once its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the timeout
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
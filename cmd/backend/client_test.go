@@ -0,0 +1,156 @@
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kgent/cmd/config"
+)
+
+func TestClientGetAndDescribe(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		io.WriteString(w, `{"data": "kind: Pod", "error": ""}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		cluster string
+		call    func(c *Client) (string, error)
+		want    string
+	}{
+		{
+			name: "get as YAML",
+			call: func(c *Client) (string, error) { return c.Get(context.Background(), "pods", "default", "web-1", "") },
+			want: "GET /api/v1/resources/pods/web-1?format=&ns=default",
+		},
+		{
+			name: "get as JSON",
+			call: func(c *Client) (string, error) { return c.Get(context.Background(), "Pod", "", "web-1", FormatJSON) },
+			want: "GET /api/v1/resources/pod/web-1?format=json&ns=",
+		},
+		{
+			name:    "get on a cluster",
+			cluster: "prod",
+			call: func(c *Client) (string, error) {
+				return c.Get(context.Background(), "deployments.apps", "shop", "web", FormatYAML)
+			},
+			want: "GET /api/v1/resources/deployments.apps/web?cluster=prod&format=yaml&ns=shop",
+		},
+		{
+			name: "get an escaped name",
+			call: func(c *Client) (string, error) {
+				return c.Get(context.Background(), "configmaps", "default", "a b/c", "")
+			},
+			want: "GET /api/v1/resources/configmaps/a%20b%2Fc?format=&ns=default",
+		},
+		{
+			name: "describe",
+			call: func(c *Client) (string, error) { return c.Describe(context.Background(), "pods", "default", "web-1") },
+			want: "GET /api/v1/resources/pods/web-1/describe?ns=default",
+		},
+		{
+			name:    "describe on a cluster",
+			cluster: "prod",
+			call:    func(c *Client) (string, error) { return c.Describe(context.Background(), "nodes", "", "node-1") },
+			want:    "GET /api/v1/resources/nodes/node-1/describe?cluster=prod&ns=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			c, err := New(server.URL+"/api/v1/resources/", tt.cluster, 0, config.BackendAuth{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := tt.call(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data != "kind: Pod" {
+				t.Errorf("data = %q", data)
+			}
+			if len(requests) != 1 || requests[0] != tt.want {
+				t.Errorf("requests = %q, want %q", requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	certFile, keyFile := writeClientCert(t)
+
+	for _, auth := range []config.BackendAuth{{CertFile: certFile}, {KeyFile: keyFile}} {
+		if _, err := New("https://kgent.invalid/api/v1/resources", "", 0, auth); err == nil || !strings.Contains(err.Error(), "cert_file and key_file") {
+			t.Errorf("New(%+v) error = %v, want both files required", auth, err)
+		}
+	}
+
+	auth := config.BackendAuth{CertFile: certFile, KeyFile: keyFile}
+	first, err := newTransport(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The files are not read again for the same configuration
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	second, err := newTransport(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("newTransport did not reuse the transport of the same certificate")
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key as PEM files
+func writeClientCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kgent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,245 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster lists, creates and deletes the resources of a Kubernetes cluster. The results are
+// the data of the responses of the Kgent API, which is served on top of it.
+type Cluster struct {
+	Dynamic dynamic.Interface
+	// Mapper resolves resource types such as pod, deploy or deployments.apps
+	Mapper meta.RESTMapper
+}
+
+// kubeconfigCluster connects to the cluster of a kubeconfig context
+func kubeconfigCluster(kubeconfig string, context string) (*Cluster, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: context}).ClientConfig()
+	// The context comes from the cluster parameter of a request, so an unknown one is the
+	// caller's error
+	if err != nil {
+		return nil, badRequest("failed to load the kubeconfig: %v", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, nil)
+	return &Cluster{Dynamic: dynamicClient, Mapper: mapper}, nil
+}
+
+// currentContext returns the current context of a kubeconfig file, empty for the service
+// account when running in a pod
+func currentContext(kubeconfig string) (string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+	return raw.CurrentContext, nil
+}
+
+// List returns the names of the resources of a type as a JSON array. Without a namespace the
+// resources of all namespaces are listed as namespace/name.
+func (c *Cluster) List(ctx context.Context, resource string, namespace string) (string, error) {
+	mapping, err := mappingFor(c.Mapper, resource)
+	if err != nil {
+		return "", err
+	}
+	list, err := c.resourceClient(mapping, namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		if namespace == "" && item.GetNamespace() != "" {
+			names = append(names, item.GetNamespace()+"/"+item.GetName())
+		} else {
+			names = append(names, item.GetName())
+		}
+	}
+	data, _ := json.Marshal(names)
+	return string(data), nil
+}
+
+// Create creates the resources of the YAML documents of a definition, which must all be of
+// the type resource. Namespaced resources without a namespace are created in namespace, or in
+// default without one.
+func (c *Cluster) Create(ctx context.Context, resource string, namespace string, yaml string) (string, error) {
+	mapping, err := mappingFor(c.Mapper, resource)
+	if err != nil {
+		return "", err
+	}
+	objects, err := decodeObjects(yaml)
+	if err != nil {
+		return "", err
+	}
+
+	// Check every document before creating anything
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		if gvk.GroupKind() != mapping.GroupVersionKind.GroupKind() {
+			return "", badRequest("the definition of %s is a %s, not a %s", obj.GetName(), gvk.Kind, mapping.GroupVersionKind.Kind)
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			continue
+		}
+		if namespace != "" && obj.GetNamespace() != "" && obj.GetNamespace() != namespace {
+			return "", badRequest("the namespace %s of %s does not match the ns parameter %s", obj.GetNamespace(), obj.GetName(), namespace)
+		}
+		obj.SetNamespace(cmp.Or(obj.GetNamespace(), namespace, metav1.NamespaceDefault))
+	}
+
+	var created []string
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		versioned, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return "", partial(created, err)
+		}
+		result, err := c.resourceClient(versioned, obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil {
+			return "", partial(created, err)
+		}
+		created = append(created, describe(versioned, result.GetNamespace(), result.GetName())+" created")
+	}
+	return strings.Join(created, "\n"), nil
+}
+
+// Delete deletes a resource by name, in the default namespace without a namespace
+func (c *Cluster) Delete(ctx context.Context, resource string, namespace string, name string) (string, error) {
+	if name == "" {
+		return "", badRequest("the name parameter is required")
+	}
+	mapping, err := mappingFor(c.Mapper, resource)
+	if err != nil {
+		return "", err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = ""
+	} else if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	if err := c.resourceClient(mapping, namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return "", err
+	}
+	return describe(mapping, namespace, name) + " deleted", nil
+}
+
+// resourceClient returns the client of a resource type, in a namespace for namespaced types.
+// An empty namespace is all namespaces.
+func (c *Cluster) resourceClient(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.Dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return c.Dynamic.Resource(mapping.Resource)
+}
+
+// mappingFor resolves a resource type as kubectl does, e.g. pod, pods, deployments.apps or
+// deployments.v1.apps
+func mappingFor(mapper meta.RESTMapper, resource string) (*meta.RESTMapping, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(resource))
+	var gvr schema.GroupVersionResource
+	var err error
+	if fullySpecified != nil {
+		gvr, err = mapper.ResourceFor(*fullySpecified)
+	}
+	if fullySpecified == nil || err != nil {
+		gvr, err = mapper.ResourceFor(groupResource.WithVersion(""))
+	}
+	if meta.IsNoMatchError(err) {
+		return nil, fmt.Errorf("unknown resource type %q: %w", resource, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// decodeObjects decodes the YAML or JSON documents of a resource definition
+func decodeObjects(definition string) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(definition), 4096)
+	var objects []*unstructured.Unstructured
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, badRequest("invalid resource definition: %v", err)
+		}
+		// Empty documents, e.g. after a trailing ---
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, badRequest("invalid resource definition: apiVersion and kind are required")
+		}
+		objects = append(objects, obj)
+	}
+	if len(objects) == 0 {
+		return nil, badRequest("the yaml field has no resource definition")
+	}
+	return objects, nil
+}
+
+// describe names a resource as resource/name, followed by its namespace
+func describe(mapping *meta.RESTMapping, namespace string, name string) string {
+	s := mapping.Resource.Resource + "/" + name
+	if namespace != "" {
+		s += " in namespace " + namespace
+	}
+	return s
+}
+
+// partial adds the resources that were created before a failure to its error
+func partial(created []string, err error) error {
+	if len(created) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (already done: %s)", err, strings.Join(created, ", "))
+}
+
+// requestError is an invalid request
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+// Formats of Get
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// Limits of Describe
+const (
+	maxOwnerDepth   = 5
+	maxRecentEvents = 10
+)
+
+// lastAppliedAnnotation holds the object as last applied by kubectl
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// eventsResource is the core events API, whose resources reference the objects they are about
+var eventsResource = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// Get returns a resource by name as YAML or as JSON, without the managed fields and the last
+// applied configuration that only repeat the object. An empty namespace is default.
+func (c *Cluster) Get(ctx context.Context, resource string, namespace string, name string, format string) (string, error) {
+	format = cmp.Or(format, FormatYAML)
+	if format != FormatYAML && format != FormatJSON {
+		return "", badRequest("invalid format %q, use %s or %s", format, FormatYAML, FormatJSON)
+	}
+	obj, _, err := c.get(ctx, resource, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	return encodeObject(obj, format)
+}
+
+// Describe returns a resource by name with its conditions, the chain of its owners and its
+// recent events, followed by the object as YAML. An empty namespace is default.
+func (c *Cluster) Describe(ctx context.Context, resource string, namespace string, name string) (string, error) {
+	obj, mapping, err := c.get(ctx, resource, namespace, name)
+	if err != nil {
+		return "", err
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "Kind: %s\n", mapping.GroupVersionKind.Kind)
+	fmt.Fprintf(&s, "Name: %s\n", obj.GetName())
+	if obj.GetNamespace() != "" {
+		fmt.Fprintf(&s, "Namespace: %s\n", obj.GetNamespace())
+	}
+	if created := obj.GetCreationTimestamp(); !created.IsZero() {
+		fmt.Fprintf(&s, "Created: %s ago\n", age(created.Time))
+	}
+	if phase, ok, _ := unstructured.NestedString(obj.Object, "status", "phase"); ok {
+		fmt.Fprintf(&s, "Phase: %s\n", phase)
+	}
+
+	s.WriteString("\nConditions:\n")
+	writeConditions(&s, obj)
+
+	s.WriteString("\nOwners:\n")
+	c.writeOwners(ctx, &s, obj)
+
+	s.WriteString("\nEvents:\n")
+	if err := c.writeEvents(ctx, &s, obj); err != nil {
+		fmt.Fprintf(&s, "  failed to list the events: %v\n", err)
+	}
+
+	object, err := encodeObject(obj, FormatYAML)
+	if err != nil {
+		return "", err
+	}
+	s.WriteString("\nObject:\n")
+	s.WriteString(object)
+	return s.String(), nil
+}
+
+// get fetches a resource by name, in the default namespace without a namespace
+func (c *Cluster) get(ctx context.Context, resource string, namespace string, name string) (*unstructured.Unstructured, *meta.RESTMapping, error) {
+	if name == "" {
+		return nil, nil, badRequest("the name parameter is required")
+	}
+	mapping, err := mappingFor(c.Mapper, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = ""
+	} else if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	obj, err := c.resourceClient(mapping, namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj, mapping, nil
+}
+
+// writeConditions writes the status conditions of an object as a table
+func writeConditions(s *strings.Builder, obj *unstructured.Unstructured) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if len(conditions) == 0 {
+		s.WriteString("  none\n")
+		return
+	}
+
+	w := tabwriter.NewWriter(s, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tLAST TRANSITION\tMESSAGE")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		transition := "-"
+		if t, err := time.Parse(time.RFC3339, fmt.Sprint(condition["lastTransitionTime"])); err == nil {
+			transition = age(t) + " ago"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", field(condition, "type"), field(condition, "status"), field(condition, "reason"), transition, field(condition, "message"))
+	}
+	w.Flush()
+}
+
+// writeOwners writes the chain of the owners of an object, following the controller or the
+// first owner of each object up to maxOwnerDepth
+func (c *Cluster) writeOwners(ctx context.Context, s *strings.Builder, obj *unstructured.Unstructured) {
+	owner := ownerOf(obj)
+	if owner == nil {
+		s.WriteString("  none\n")
+		return
+	}
+
+	for depth := 1; owner != nil; depth++ {
+		indent := strings.Repeat("  ", depth)
+		controller := ""
+		if owner.Controller != nil && *owner.Controller {
+			controller = " (controller)"
+		}
+		fmt.Fprintf(s, "%s%s/%s%s\n", indent, owner.Kind, owner.Name, controller)
+		if depth == maxOwnerDepth {
+			break
+		}
+
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil {
+			return
+		}
+		mapping, err := c.Mapper.RESTMapping(gv.WithKind(owner.Kind).GroupKind(), gv.Version)
+		if err != nil {
+			fmt.Fprintf(s, "%s  cannot be fetched: %v\n", indent, err)
+			return
+		}
+		namespace := ""
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace = obj.GetNamespace()
+		}
+		next, err := c.resourceClient(mapping, namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			fmt.Fprintf(s, "%s  cannot be fetched: %v\n", indent, err)
+			return
+		}
+		obj, owner = next, ownerOf(next)
+	}
+}
+
+// ownerOf returns the controller of an object, or its first owner
+func ownerOf(obj *unstructured.Unstructured) *metav1.OwnerReference {
+	refs := obj.GetOwnerReferences()
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
+		}
+	}
+	if len(refs) > 0 {
+		return &refs[0]
+	}
+	return nil
+}
+
+// writeEvents writes the most recent events about an object, oldest first
+func (c *Cluster) writeEvents(ctx context.Context, s *strings.Builder, obj *unstructured.Unstructured) error {
+	list, err := c.Dynamic.Resource(eventsResource).Namespace(obj.GetNamespace()).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.uid=" + string(obj.GetUID()),
+	})
+	if err != nil {
+		return err
+	}
+
+	type event struct {
+		last                          time.Time
+		kind, reason, message, source string
+		count                         int64
+	}
+	var events []event
+	for _, item := range list.Items {
+		// The field selector is not applied by every API, e.g. the fake client of tests
+		if uid, _, _ := unstructured.NestedString(item.Object, "involvedObject", "uid"); uid != string(obj.GetUID()) {
+			continue
+		}
+		e := event{
+			kind:    field(item.Object, "type"),
+			reason:  field(item.Object, "reason"),
+			message: strings.TrimSpace(field(item.Object, "message")),
+		}
+		e.count, _, _ = unstructured.NestedInt64(item.Object, "count")
+		for _, key := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+			if t, err := time.Parse(time.RFC3339, field(item.Object, key)); err == nil {
+				e.last = t
+				break
+			}
+		}
+		events = append(events, e)
+	}
+	if len(events) == 0 {
+		s.WriteString("  none\n")
+		return nil
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].last.Before(events[j].last) })
+	if len(events) > maxRecentEvents {
+		events = events[len(events)-maxRecentEvents:]
+	}
+
+	w := tabwriter.NewWriter(s, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  LAST SEEN\tTYPE\tREASON\tCOUNT\tMESSAGE")
+	for _, e := range events {
+		seen := "-"
+		if !e.last.IsZero() {
+			seen = age(e.last) + " ago"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\n", seen, e.kind, e.reason, max(e.count, 1), e.message)
+	}
+	return w.Flush()
+}
+
+// encodeObject encodes an object without its managed fields and last applied configuration
+func encodeObject(obj *unstructured.Unstructured, format string) (string, error) {
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	if annotations := obj.GetAnnotations(); annotations[lastAppliedAnnotation] != "" {
+		delete(annotations, lastAppliedAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+
+	if format == FormatJSON {
+		data, err := json.Marshal(obj.Object)
+		return string(data), err
+	}
+	data, err := yaml.Marshal(obj.Object)
+	return string(data), err
+}
+
+// field returns a string field of an object, or an empty string
+func field(obj map[string]interface{}, key string) string {
+	value, ok := obj[key].(string)
+	if !ok {
+		return ""
+	}
+	return value
+}
+
+// age returns the time since t, e.g. 5m or 3d4h
+func age(t time.Time) string {
+	return duration.HumanDuration(time.Since(t))
+}
@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerGetAndDescribe(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   []string
+		reject []string
+	}{
+		{
+			name:   "get",
+			target: "/api/v1/resources/pod/web-5d8f-x2",
+			status: http.StatusOK, want: []string{"name: web-5d8f-x2", "team: web", "phase: Running"},
+			reject: []string{"managedFields", "last-applied-configuration"},
+		},
+		{
+			name:   "get as JSON",
+			target: "/api/v1/resources/pods/web-5d8f-x2?ns=default&format=json",
+			status: http.StatusOK, want: []string{`"name":"web-5d8f-x2"`},
+		},
+		{
+			name:   "get in an invalid format",
+			target: "/api/v1/resources/pods/web-5d8f-x2?format=xml",
+			status: http.StatusBadRequest, want: []string{`invalid format "xml"`},
+		},
+		{
+			name:   "describe",
+			target: "/api/v1/resources/pods/web-5d8f-x2/describe?ns=default",
+			status: http.StatusOK,
+			want: []string{
+				"Kind: Pod", "Namespace: default", "Phase: Running",
+				"Ready", "ContainersNotReady",
+				"  ReplicaSet/web-5d8f (controller)\n    Deployment/web (controller)\n",
+				"Warning", "BackOff", "Back-off restarting failed container",
+				"Object:\n",
+			},
+			reject: []string{"event of another pod"},
+		},
+		{
+			name:   "describe without owners or events",
+			target: "/api/v1/resources/deployments/web/describe",
+			status: http.StatusOK, want: []string{"Conditions:\n  none\n", "Owners:\n  none\n", "Events:\n  none\n"},
+		},
+		{
+			name:   "missing resource",
+			target: "/api/v1/resources/pods/api",
+			status: http.StatusNotFound, want: []string{`"api" not found`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, _ := newTestCluster(t)
+			status, data := serve(t, NewServer(cluster), http.MethodGet, tt.target, "")
+			if status != tt.status {
+				t.Errorf("status = %d, want %d: %s", status, tt.status, data)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(data, want) {
+					t.Errorf("response does not contain %q:\n%s", want, data)
+				}
+			}
+			for _, reject := range tt.reject {
+				if strings.Contains(data, reject) {
+					t.Errorf("response contains %q:\n%s", reject, data)
+				}
+			}
+		})
+	}
+}
+
+// TestDescribeLimits checks that the owner chain stops at maxOwnerDepth and that only the
+// maxRecentEvents latest events are shown, oldest first
+func TestDescribeLimits(t *testing.T) {
+	cluster, client := newTestCluster(t)
+
+	// rs-0 is owned by rs-1, which is owned by rs-2, and so on up to rs-7
+	for i := 0; i <= 7; i++ {
+		owners := ""
+		if i < 7 {
+			owners = fmt.Sprintf(`, "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "rs-%d", "uid": "u-rs-%d"}]`, i+1, i+1)
+		}
+		rs := object(t, fmt.Sprintf(`{"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": {"name": "rs-%d", "namespace": "default", "uid": "u-rs-%d"%s}}`, i, i, owners))
+		if err := client.Tracker().Add(rs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The events of rs-0 are added newest first, their order comes from their timestamps
+	for i := 12; i >= 1; i-- {
+		last := time.Now().Add(-time.Duration(i) * time.Minute).UTC().Format(time.RFC3339)
+		event := object(t, fmt.Sprintf(`{"apiVersion": "v1", "kind": "Event", "metadata": {"name": "rs-0.%d", "namespace": "default"},
+			"involvedObject": {"kind": "ReplicaSet", "name": "rs-0", "uid": "u-rs-0"},
+			"type": "Normal", "reason": "Scaled", "message": "event %02d", "lastTimestamp": "%s"}`, i, 13-i, last))
+		if err := client.Tracker().Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := cluster.Describe(context.Background(), "replicasets", "", "rs-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := data[strings.Index(data, "Owners:\n"):strings.Index(data, "Events:\n")]
+	want := "Owners:\n  ReplicaSet/rs-1\n    ReplicaSet/rs-2\n      ReplicaSet/rs-3\n        ReplicaSet/rs-4\n          ReplicaSet/rs-5\n\n"
+	if owners != want {
+		t.Errorf("owners = %q, want %q", owners, want)
+	}
+
+	events := data[strings.Index(data, "Events:\n"):strings.Index(data, "Object:\n")]
+	for i := 1; i <= 12; i++ {
+		if shown := strings.Contains(events, fmt.Sprintf("event %02d", i)); shown != (i > 2) {
+			t.Errorf("event %02d shown = %v:\n%s", i, shown, events)
+		}
+	}
+	if first, last := strings.Index(events, "event 03"), strings.Index(events, "event 12"); first > last {
+		t.Errorf("events are not oldest first:\n%s", events)
+	}
+}
+
+func TestDescribeMissingOwner(t *testing.T) {
+	cluster, client := newTestCluster(t)
+	pod := object(t, `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "orphan", "namespace": "default", "uid": "u-orphan",
+		"ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "gone", "uid": "u-gone"}]}}`)
+	if err := client.Tracker().Add(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := cluster.Describe(context.Background(), "pod", "default", "orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(data, "  ReplicaSet/gone\n    cannot be fetched: ") {
+		t.Errorf("describe does not report the missing owner:\n%s", data)
+	}
+}
+
+func TestGetWithoutName(t *testing.T) {
+	cluster, _ := newTestCluster(t)
+	_, err := cluster.Get(context.Background(), "pods", "default", "", "")
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		t.Errorf("error = %v, want a request error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package backend
+
+import (
+	"context"
+	"sync"
+
+	"kgent/cmd/config"
+)
+
+// Resources lists, fetches, creates and deletes resources. It is implemented by the client of
+// the Kgent API and, for --backend=direct, by the cluster of the kubeconfig.
+type Resources interface {
+	List(ctx context.Context, resource string, namespace string) (string, error)
+	Get(ctx context.Context, resource string, namespace string, name string, format string) (string, error)
+	Describe(ctx context.Context, resource string, namespace string, name string) (string, error)
+	Create(ctx context.Context, resource string, namespace string, yaml string) (string, error)
+	Delete(ctx context.Context, resource string, namespace string, name string) (string, error)
+}
+
+// Connections to the clusters of --backend=direct, kept for the discovery cache
+var (
+	directMu       sync.Mutex
+	directClusters = map[[2]string]*Cluster{}
+)
+
+// ResourcesFromConfig returns the resources of the backend of the active configuration: the
+// Kgent API, or the Kubernetes API of the selected kubeconfig context in direct mode
+func ResourcesFromConfig() (Resources, error) {
+	if config.Active.Backend != config.BackendDirect {
+		return FromConfig()
+	}
+
+	directMu.Lock()
+	defer directMu.Unlock()
+	key := [2]string{config.Active.Kubeconfig, config.Active.KubeContext}
+	if c, ok := directClusters[key]; ok {
+		return c, nil
+	}
+	c, err := kubeconfigCluster(config.Active.Kubeconfig, config.Active.KubeContext)
+	if err != nil {
+		return nil, err
+	}
+	directClusters[key] = c
+	return c, nil
+}
@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// maxRequestBody limits the size of a resource definition
+const maxRequestBody = 1 << 20
+
+var (
+	// errMissingToken rejects a request without the bearer token of the server
+	errMissingToken = errors.New("missing or invalid bearer token")
+	// errClusterNotServed rejects a request for a kubeconfig context the server does not serve
+	errClusterNotServed = errors.New("the server does not serve the cluster")
+)
+
+// Server implements the Kgent API: the resources endpoint and the health endpoint
+type Server struct {
+	// Logf, if set, is called for every request with the status of the response
+	Logf func(format string, args ...interface{})
+	// Token, if set, is the bearer token that requests to the resources endpoint must send.
+	// The health endpoint stays open for probes.
+	Token string
+
+	cluster func(name string) (*Cluster, error)
+	mux     *http.ServeMux
+}
+
+// NewServer creates a server working on a single cluster, the cluster parameter of the
+// requests is ignored. Use it with the fake dynamic client of client-go in tests.
+func NewServer(cluster *Cluster) *Server {
+	return newServer(func(string) (*Cluster, error) { return cluster, nil })
+}
+
+// NewKubeconfigServer creates a server working on the contexts of a kubeconfig file, empty for
+// the default kubeconfig or the service account when running in a pod. defaultContext is used
+// for requests without a cluster parameter, empty for the current context. The cluster
+// parameter may only select defaultContext or one of allowedContexts, so a caller cannot reach
+// every cluster of the kubeconfig.
+func NewKubeconfigServer(kubeconfig string, defaultContext string, allowedContexts []string) (*Server, error) {
+	if defaultContext == "" {
+		current, err := currentContext(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		defaultContext = current
+	}
+	allowed := map[string]bool{"": true, defaultContext: true}
+	for _, name := range allowedContexts {
+		allowed[name] = true
+	}
+
+	// One connection per allowed context at most, kept for the discovery cache
+	var mu sync.Mutex
+	clusters := map[string]*Cluster{}
+	s := newServer(func(name string) (*Cluster, error) {
+		if !allowed[name] {
+			return nil, fmt.Errorf("%w: %q", errClusterNotServed, name)
+		}
+		name = cmp.Or(name, defaultContext)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if c, ok := clusters[name]; ok {
+			return c, nil
+		}
+		c, err := kubeconfigCluster(kubeconfig, name)
+		if err != nil {
+			return nil, err
+		}
+		clusters[name] = c
+		return c, nil
+	})
+
+	// Fail at startup rather than on the first request if the default cluster is not usable
+	if _, err := s.cluster(""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newServer(cluster func(name string) (*Cluster, error)) *Server {
+	s := &Server{cluster: cluster, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /health", s.health)
+	s.mux.HandleFunc("GET /api/v1/resources/{resource}", s.list)
+	s.mux.HandleFunc("GET /api/v1/resources/{resource}/{name}", s.get)
+	s.mux.HandleFunc("GET /api/v1/resources/{resource}/{name}/describe", s.describe)
+	s.mux.HandleFunc("POST /api/v1/resources/{resource}", s.create)
+	s.mux.HandleFunc("DELETE /api/v1/resources/{resource}", s.delete)
+	return s
+}
+
+// ServeHTTP serves the Kgent API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.URL.Path != "/health" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kgent"`)
+		s.reply(w, r, "", errMissingToken)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether the request sends the bearer token of the server
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// health answers the health check
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	s.reply(w, r, "ok", nil)
+}
+
+// list lists the resources of a type
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.cluster(r.URL.Query().Get("cluster"))
+	if err != nil {
+		s.reply(w, r, "", err)
+		return
+	}
+	data, err := cluster.List(r.Context(), r.PathValue("resource"), r.URL.Query().Get("ns"))
+	s.reply(w, r, data, err)
+}
+
+// get returns a resource by name
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.cluster(r.URL.Query().Get("cluster"))
+	if err != nil {
+		s.reply(w, r, "", err)
+		return
+	}
+	query := r.URL.Query()
+	data, err := cluster.Get(r.Context(), r.PathValue("resource"), query.Get("ns"), r.PathValue("name"), query.Get("format"))
+	s.reply(w, r, data, err)
+}
+
+// describe returns a resource by name with its conditions, owners and recent events
+func (s *Server) describe(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.cluster(r.URL.Query().Get("cluster"))
+	if err != nil {
+		s.reply(w, r, "", err)
+		return
+	}
+	data, err := cluster.Describe(r.Context(), r.PathValue("resource"), r.URL.Query().Get("ns"), r.PathValue("name"))
+	s.reply(w, r, data, err)
+}
+
+// create creates the resources of the body {"yaml": "..."}
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.cluster(r.URL.Query().Get("cluster"))
+	if err != nil {
+		s.reply(w, r, "", err)
+		return
+	}
+
+	var body struct {
+		YAML string `json:"yaml"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&body); err != nil {
+		s.reply(w, r, "", badRequest("invalid request body: %v", err))
+		return
+	}
+	data, err := cluster.Create(r.Context(), r.PathValue("resource"), r.URL.Query().Get("ns"), body.YAML)
+	s.reply(w, r, data, err)
+}
+
+// delete deletes a resource by name
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	cluster, err := s.cluster(r.URL.Query().Get("cluster"))
+	if err != nil {
+		s.reply(w, r, "", err)
+		return
+	}
+	query := r.URL.Query()
+	data, err := cluster.Delete(r.Context(), r.PathValue("resource"), query.Get("ns"), query.Get("name"))
+	s.reply(w, r, data, err)
+}
+
+// statusOf maps an error to the HTTP status of the response. Kubernetes API errors keep their
+// status, except rejected credentials of the server itself, which are not the caller's.
+func statusOf(err error) int {
+	var reqErr *requestError
+	var apiStatus apierrors.APIStatus
+	switch {
+	case errors.Is(err, errMissingToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, errClusterNotServed):
+		return http.StatusForbidden
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case meta.IsNoMatchError(err):
+		return http.StatusNotFound
+	case apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err):
+		return http.StatusBadGateway
+	case errors.As(err, &apiStatus) && apiStatus.Status().Code >= 400:
+		return int(apiStatus.Status().Code)
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// reply writes the response envelope, with the data or the error
+func (s *Server) reply(w http.ResponseWriter, r *http.Request, data string, err error) {
+	status := http.StatusOK
+	env := struct {
+		Data  string `json:"data"`
+		Error string `json:"error,omitempty"`
+	}{Data: data}
+	if err != nil {
+		status = statusOf(err)
+		env.Error = err.Error()
+	}
+
+	if s.Logf != nil && err != nil {
+		s.Logf("%s %s -> %d: %s", r.Method, r.URL.RequestURI(), status, env.Error)
+	} else if s.Logf != nil {
+		s.Logf("%s %s -> %d", r.Method, r.URL.RequestURI(), status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(env)
+}
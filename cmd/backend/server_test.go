@@ -0,0 +1,324 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	podsResource    = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	secretsResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// newTestCluster returns a cluster on the fake dynamic client with a deployment web, its
+// replica set and its pod, and the events of the pod
+func newTestCluster(t *testing.T) (*Cluster, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Pod"},
+		{Version: "v1", Kind: "Secret"},
+		{Version: "v1", Kind: "Event"},
+		{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	objects := []runtime.Object{
+		object(t, `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "default", "uid": "u-deploy"}}`),
+		object(t, `{"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": {"name": "web-5d8f", "namespace": "default", "uid": "u-rs",
+			"ownerReferences": [{"apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "u-deploy", "controller": true}]}}`),
+		object(t, `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web-5d8f-x2", "namespace": "default", "uid": "u-pod",
+			"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{}", "team": "web"},
+			"managedFields": [{"manager": "kubectl", "operation": "Apply"}],
+			"ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web-5d8f", "uid": "u-rs", "controller": true}]},
+			"status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False", "reason": "ContainersNotReady", "message": "containers with unready status: [app]"}]}}`),
+		object(t, `{"apiVersion": "v1", "kind": "Event", "metadata": {"name": "web-5d8f-x2.1", "namespace": "default"},
+			"involvedObject": {"kind": "Pod", "name": "web-5d8f-x2", "uid": "u-pod"},
+			"type": "Warning", "reason": "BackOff", "message": "Back-off restarting failed container", "count": 4, "lastTimestamp": "`+now+`"}`),
+		object(t, `{"apiVersion": "v1", "kind": "Event", "metadata": {"name": "other.1", "namespace": "default"},
+			"involvedObject": {"kind": "Pod", "name": "other", "uid": "u-other"},
+			"type": "Normal", "reason": "Pulled", "message": "event of another pod"}`),
+	}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		podsResource:                        "PodList",
+		secretsResource:                     "SecretList",
+		{Version: "v1", Resource: "events"}: "EventList",
+		{Group: "apps", Version: "v1", Resource: "replicasets"}: "ReplicaSetList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+	}, objects...)
+	return &Cluster{Dynamic: client, Mapper: mapper}, client
+}
+
+// object decodes a JSON object
+func object(t *testing.T, data string) *unstructured.Unstructured {
+	t.Helper()
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(data), &obj.Object); err != nil {
+		t.Fatalf("invalid object %s: %v", data, err)
+	}
+	return obj
+}
+
+// serve sends a request to the server and returns the status and the data or the error of
+// the envelope
+func serve(t *testing.T, s *Server, method string, target string, body string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	var env struct {
+		Data  string `json:"data"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("%s %s: invalid envelope %q: %v", method, target, rec.Body.String(), err)
+	}
+	if env.Error != "" {
+		return rec.Code, env.Error
+	}
+	return rec.Code, env.Data
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		want   []string
+		reject []string
+	}{
+		{
+			name:   "list",
+			method: http.MethodGet, target: "/api/v1/resources/pods?ns=default",
+			status: http.StatusOK, want: []string{`["web-5d8f-x2"]`},
+		},
+		{
+			name:   "list all namespaces",
+			method: http.MethodGet, target: "/api/v1/resources/deployments.apps",
+			status: http.StatusOK, want: []string{`["default/web"]`},
+		},
+		{
+			name:   "unknown resource type",
+			method: http.MethodGet, target: "/api/v1/resources/widgets",
+			status: http.StatusNotFound, want: []string{`unknown resource type "widgets"`},
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete, target: "/api/v1/resources/deployments?ns=default&name=web",
+			status: http.StatusOK, want: []string{"deployments/web in namespace default deleted"},
+		},
+		{
+			name:   "delete a missing resource",
+			method: http.MethodDelete, target: "/api/v1/resources/pods?name=api",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "delete without a name",
+			method: http.MethodDelete, target: "/api/v1/resources/pods",
+			status: http.StatusBadRequest, want: []string{"the name parameter is required"},
+		},
+		{
+			name:   "create",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: api\n"}`,
+			status: http.StatusOK, want: []string{"pods/api in namespace default created"},
+		},
+		{
+			name:   "create in the namespace of the request",
+			method: http.MethodPost, target: "/api/v1/resources/pods?ns=tools",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: api\n"}`,
+			status: http.StatusOK, want: []string{"pods/api in namespace tools created"},
+		},
+		{
+			name:   "create with another namespace than the request",
+			method: http.MethodPost, target: "/api/v1/resources/pods?ns=tools",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: api\n  namespace: default\n"}`,
+			status: http.StatusBadRequest, want: []string{"does not match the ns parameter tools"},
+		},
+		{
+			name:   "create another type than the resource",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: db\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n"}`,
+			status: http.StatusBadRequest, want: []string{"the definition of api is a Deployment, not a Pod"}, reject: []string{"created"},
+		},
+		{
+			name:   "create an unknown resource type",
+			method: http.MethodPost, target: "/api/v1/resources/widgets",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: api\n"}`,
+			status: http.StatusNotFound, want: []string{`unknown resource type "widgets"`},
+		},
+		{
+			name:   "create an existing resource",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web-5d8f-x2\n  namespace: default\n"}`,
+			status: http.StatusConflict, want: []string{"already exists"},
+		},
+		{
+			name:   "create partially",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: db\n---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: web-5d8f-x2\n"}`,
+			status: http.StatusConflict, want: []string{"already exists", "already done: pods/db in namespace default created"},
+		},
+		{
+			name:   "create an invalid definition",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `{"yaml": "kind: Pod\n"}`,
+			status: http.StatusBadRequest, want: []string{"apiVersion and kind are required"},
+		},
+		{
+			name:   "create with an invalid body",
+			method: http.MethodPost, target: "/api/v1/resources/pods",
+			body:   `apiVersion: v1`,
+			status: http.StatusBadRequest, want: []string{"invalid request body"},
+		},
+		{
+			name:   "credentials of the server rejected",
+			method: http.MethodGet, target: "/api/v1/resources/secrets?ns=default",
+			status: http.StatusBadGateway, want: []string{"forbidden"},
+		},
+		{
+			name:   "health",
+			method: http.MethodGet, target: "/health",
+			status: http.StatusOK, want: []string{"ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, client := newTestCluster(t)
+			client.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+			})
+
+			status, data := serve(t, NewServer(cluster), tt.method, tt.target, tt.body)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d: %s", status, tt.status, data)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(data, want) {
+					t.Errorf("response does not contain %q:\n%s", want, data)
+				}
+			}
+			for _, reject := range tt.reject {
+				if strings.Contains(data, reject) {
+					t.Errorf("response contains %q:\n%s", reject, data)
+				}
+			}
+		})
+	}
+}
+
+func TestServerCreateThenGet(t *testing.T) {
+	cluster, _ := newTestCluster(t)
+	s := NewServer(cluster)
+
+	status, data := serve(t, s, http.MethodPost, "/api/v1/resources/pods", `{"yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: api\n  namespace: tools\n"}`)
+	if status != http.StatusOK {
+		t.Fatalf("create: status %d: %s", status, data)
+	}
+	if status, data = serve(t, s, http.MethodGet, "/api/v1/resources/pods?ns=tools", ""); data != `["api"]` {
+		t.Errorf("list after create: status %d: %s", status, data)
+	}
+	if status, data = serve(t, s, http.MethodDelete, "/api/v1/resources/pods?ns=tools&name=api", ""); status != http.StatusOK {
+		t.Errorf("delete: status %d: %s", status, data)
+	}
+	if status, data = serve(t, s, http.MethodGet, "/api/v1/resources/pods?ns=tools", ""); data != `[]` {
+		t.Errorf("list after delete: status %d: %s", status, data)
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	cluster, _ := newTestCluster(t)
+	s := NewServer(cluster)
+	s.Token = "s3cret"
+
+	if status, _ := serve(t, s, http.MethodGet, "/api/v1/resources/pods", ""); status != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want 401", status)
+	}
+	if status, _ := serve(t, s, http.MethodGet, "/health", ""); status != http.StatusOK {
+		t.Errorf("health without token: status %d, want 200", status)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/resources/pods", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("with token: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+}
+
+// testKubeconfig has the contexts dev (current), staging and prod, on clusters that refuse
+// connections
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: local
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: dev
+  context: {cluster: local, user: admin}
+- name: staging
+  context: {cluster: local, user: admin}
+- name: prod
+  context: {cluster: local, user: admin}
+users:
+- name: admin
+  user: {token: test}
+`
+
+func TestKubeconfigServerContexts(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewKubeconfigServer(kubeconfig, "", []string{"staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cluster string
+		served  bool
+	}{
+		{"", true},
+		{"dev", true},
+		{"staging", true},
+		{"prod", false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		status, data := serve(t, s, http.MethodGet, "/api/v1/resources/pods?cluster="+tt.cluster, "")
+		if served := status != http.StatusForbidden; served != tt.served {
+			t.Errorf("cluster %q: status %d, want served %v: %s", tt.cluster, status, tt.served, data)
+		}
+	}
+
+	if _, err := NewKubeconfigServer(kubeconfig, "missing", nil); err == nil {
+		t.Error("NewKubeconfigServer accepted a missing default context")
+	}
+}
@@ -0,0 +1,376 @@
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Modes of a cassette
+const (
+	// ModeRecord performs the requests and saves every exchange to the cassette
+	ModeRecord = "record"
+	// ModeReplay serves the responses of the cassette and never reaches the network
+	ModeReplay = "replay"
+)
+
+// redacted replaces the values of secret query parameters in a cassette
+const redacted = "REDACTED"
+
+// secretParams are the query parameters that carry credentials, e.g. the api_key of SerpApi
+var secretParams = []string{"api_key", "apikey", "key", "token", "access_token", "password", "secret"}
+
+// recordedHeaders are the response headers kept in a cassette, others such as Set-Cookie may
+// carry session credentials
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+// ErrNoInteraction is returned in replay mode for requests the cassette has no response for
+var ErrNoInteraction = errors.New("cassette has no recorded response for the request")
+
+// Cassette is a recording of the HTTP exchanges of a session
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+
+	path string
+	mode string
+	mu   sync.Mutex
+	// served counts how many interactions of each key were replayed
+	served map[string]int
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	// Key is the hash of the normalized request used to match replayed requests
+	Key      string   `json:"key"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the part of a request that identifies it. Headers are not recorded and secret
+// query parameters are redacted, so API keys never end up in a cassette.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+var (
+	active     *Cassette
+	activeErr  error
+	activeOnce sync.Once
+)
+
+// FromEnv returns the cassette configured with KGENT_CASSETTE and KGENT_CASSETTE_MODE, or nil
+// when no cassette is configured. The cassette is loaded once and shared by all HTTP clients.
+func FromEnv() (*Cassette, error) {
+	activeOnce.Do(func() {
+		path := os.Getenv("KGENT_CASSETTE")
+		if path == "" {
+			return
+		}
+		mode := os.Getenv("KGENT_CASSETTE_MODE")
+		if mode == "" {
+			mode = ModeReplay
+		}
+		active, activeErr = Open(path, mode)
+	})
+	return active, activeErr
+}
+
+// Open loads the cassette at path. In record mode a missing cassette is created and an
+// existing one is overwritten.
+func Open(path string, mode string) (*Cassette, error) {
+	c := &Cassette{Version: 1, path: path, mode: mode, served: map[string]int{}}
+	switch mode {
+	case ModeRecord:
+		return c, nil
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q, use %s or %s", mode, ModeRecord, ModeReplay)
+	}
+}
+
+// Transport wraps base so requests are recorded to or replayed from the cassette configured
+// in the environment. Without a cassette base is returned unchanged.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	c, err := FromEnv()
+	if err != nil {
+		return errorTransport{err: err}
+	}
+	if c == nil {
+		return base
+	}
+	return &transport{cassette: c, base: base}
+}
+
+// transport records or replays the requests of a cassette
+type transport struct {
+	cassette *Cassette
+	base     http.RoundTripper
+}
+
+// RoundTrip records or replays a request
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	key := Key(recorded)
+
+	if t.cassette.mode == ModeReplay {
+		rsp, ok := t.cassette.next(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %s (key %s)", ErrNoInteraction, recorded.Method, recorded.URL, key[:12])
+		}
+		return rsp.httpResponse(req), nil
+	}
+
+	rsp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is recorded as it is read, so streamed responses reach the caller right away
+	interaction := Interaction{Key: key, Request: recorded, Response: Response{Status: rsp.StatusCode, Headers: map[string]string{}}}
+	for _, name := range recordedHeaders {
+		if value := rsp.Header.Get(name); value != "" {
+			interaction.Response.Headers[name] = value
+		}
+	}
+	rsp.Body = &recordingBody{body: rsp.Body, cassette: t.cassette, interaction: interaction}
+	return rsp, nil
+}
+
+// next returns the next recorded response of the key. Requests repeated more often than
+// they were recorded get the last response again.
+func (c *Cassette) next(key string) (Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []Response
+	for _, interaction := range c.Interactions {
+		if interaction.Key == key {
+			matches = append(matches, interaction.Response)
+		}
+	}
+	if len(matches) == 0 {
+		return Response{}, false
+	}
+
+	i := min(c.served[key], len(matches)-1)
+	c.served[key]++
+	return matches[i], true
+}
+
+// add appends an interaction and saves the cassette, so the recording survives an abrupt exit.
+// The file is replaced at once and only readable by the user, as responses may hold cluster data.
+func (c *Cassette) add(interaction Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, interaction)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// CreateTemp creates the file with mode 0600
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// httpResponse builds the replayed response of req
+func (r Response) httpResponse(req *http.Request) *http.Response {
+	header := http.Header{}
+	for name, value := range r.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// recordingBody saves the interaction once the response body was read or closed
+type recordingBody struct {
+	body        io.ReadCloser
+	cassette    *Cassette
+	interaction Interaction
+	buf         bytes.Buffer
+	saved       bool
+}
+
+// Read reads the body and keeps a copy of it
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		b.save()
+	}
+	return n, err
+}
+
+// Close closes the body and saves what was read, e.g. of a stream stopped early
+func (b *recordingBody) Close() error {
+	b.save()
+	return b.body.Close()
+}
+
+// save adds the interaction to the cassette once
+func (b *recordingBody) save() {
+	if b.saved {
+		return
+	}
+	b.saved = true
+	b.interaction.Response.Body = b.buf.String()
+	if err := b.cassette.add(b.interaction); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save cassette: %v\n", err)
+	}
+}
+
+// readRequest captures the request and restores its body for the real transport
+func readRequest(req *http.Request) (Request, error) {
+	recorded := Request{Method: req.Method, URL: redactURL(req.URL)}
+	if req.Body == nil || req.Body == http.NoBody {
+		return recorded, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return recorded, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	recorded.Body = string(data)
+	return recorded, nil
+}
+
+// redactURL returns u with the values of secret query parameters replaced. The redacted
+// values are part of the key, so a cassette is replayed with any credentials.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for name := range query {
+		for _, secret := range secretParams {
+			if strings.EqualFold(name, secret) {
+				query[name] = []string{redacted}
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.String()
+}
+
+// Key returns the hash of the normalized request. The scheme and host are ignored so a
+// cassette can be replayed against any endpoint, query parameters are sorted and JSON bodies
+// are compared by content rather than formatting.
+func Key(req Request) string {
+	h := sha256.New()
+	h.Write([]byte(strings.ToUpper(req.Method) + " " + normalizeURL(req.URL) + "\n" + normalizeBody(req.Body)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeURL returns the path and the sorted query of rawURL
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	path := "/" + strings.Trim(u.Path, "/")
+	if len(parts) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// normalizeBody re-encodes JSON bodies with sorted keys and without formatting
+func normalizeBody(body string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return body
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+// errorTransport fails every request, e.g. when the cassette cannot be loaded
+type errorTransport struct {
+	err error
+}
+
+// RoundTrip returns the error of the transport
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
@@ -0,0 +1,128 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Retry-After", "1")
+		io.WriteString(w, `{"q": "`+r.URL.Query().Get("q")+`"}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "session.cassette.json")
+	recorder, err := Open(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &transport{cassette: recorder, base: http.DefaultTransport}}
+	if body := get(t, client, server.URL+"/search?q=pods&api_key=sk-123"); body != `{"q": "pods"}` {
+		t.Fatalf("recorded body = %s", body)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("cassette mode = %o, want 600", mode)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"sk-123", "session=secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+
+	// Replay with another host and API key, the server is not reached anymore
+	server.Close()
+	player, err := Open(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: &transport{cassette: player, base: http.DefaultTransport}}
+	rsp, err := client.Get("http://replay.invalid/search?api_key=sk-456&q=pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(body) != `{"q": "pods"}` {
+		t.Errorf("replayed body = %s", body)
+	}
+	if rsp.Header.Get("Retry-After") != "1" || rsp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("replayed headers = %v, want Retry-After and no Set-Cookie", rsp.Header)
+	}
+
+	_, err = client.Get("http://replay.invalid/search?q=services")
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("unrecorded request error = %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Request
+		same bool
+	}{
+		{
+			name: "host and query order are ignored",
+			a:    Request{Method: "GET", URL: "http://a/api/v1/resources/pods?ns=default&cluster=kind"},
+			b:    Request{Method: "get", URL: "https://b:8000/api/v1/resources/pods/?cluster=kind&ns=default"},
+			same: true,
+		},
+		{
+			name: "JSON bodies are compared by content",
+			a:    Request{Method: "POST", URL: "/v1/chat/completions", Body: `{"model": "m", "stream": false}`},
+			b:    Request{Method: "POST", URL: "/v1/chat/completions", Body: `{"stream":false,"model":"m"}`},
+			same: true,
+		},
+		{
+			name: "query values differ",
+			a:    Request{Method: "GET", URL: "/api/v1/resources/pods?ns=default"},
+			b:    Request{Method: "GET", URL: "/api/v1/resources/pods?ns=kube-system"},
+		},
+		{
+			name: "methods differ",
+			a:    Request{Method: "GET", URL: "/api/v1/resources/pods"},
+			b:    Request{Method: "DELETE", URL: "/api/v1/resources/pods"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := Key(tt.a) == Key(tt.b); same != tt.same {
+				t.Errorf("Key(a) == Key(b) is %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+// get performs a GET request and returns the body
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	rsp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
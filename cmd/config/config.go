@@ -0,0 +1,318 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
+	"kgent/cmd/utils"
+)
+
+// Defaults of the settings that are not set by a flag, the environment or the profile
+const (
+	DefaultBackendURL     = "http://localhost:8000/api/v1/resources"
+	DefaultMaxLoops       = 5
+	DefaultModelTimeout   = 30 * time.Second
+	DefaultBackendTimeout = 30 * time.Second
+)
+
+// Backends of ListTool, CreateTool and DeleteTool
+const (
+	// BackendHTTP calls the Kgent API at BackendURL
+	BackendHTTP = "http"
+	// BackendDirect calls the Kubernetes API of the kubeconfig context
+	BackendDirect = "direct"
+)
+
+// File is the content of the config file
+type File struct {
+	// DefaultProfile is used when no profile is selected with --profile or KGENT_PROFILE
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is a named set of settings. Empty settings keep their default.
+type Profile struct {
+	// Provider is the LLM provider, see KGENT_PROVIDER
+	Provider string `yaml:"provider"`
+	// Model is the model of the provider
+	Model string `yaml:"model"`
+	// Endpoint is the base URL of the model API of the provider
+	Endpoint string `yaml:"endpoint"`
+	// APIKey is the key of the model API of the provider
+	APIKey string `yaml:"api_key"`
+	// Backend is http or direct, see KGENT_BACKEND
+	Backend string `yaml:"backend"`
+	// BackendURL is the resources endpoint of the Kgent API
+	BackendURL string `yaml:"backend_url"`
+	// BackendAuth are the credentials of the Kgent API
+	BackendAuth BackendAuth `yaml:"backend_auth"`
+	// Namespace is the default namespace of chat and check
+	Namespace string `yaml:"namespace"`
+	// Context is the kubeconfig context of the cluster to work on
+	Context string `yaml:"context"`
+	// Kubeconfig is the kubeconfig file of kubectl and helm
+	Kubeconfig string `yaml:"kubeconfig"`
+	// MaxLoops is the maximum number of reasoning loops of a request
+	MaxLoops int `yaml:"max_loops"`
+	// ModelTimeout is the timeout of a model call that is not streamed, e.g. 45s
+	ModelTimeout time.Duration `yaml:"model_timeout"`
+	// BackendTimeout is the timeout of a call to the Kgent API
+	BackendTimeout time.Duration `yaml:"backend_timeout"`
+}
+
+// BackendAuth are the credentials sent to the Kgent API. A token and a username are
+// exclusive, headers are sent with every request.
+type BackendAuth struct {
+	// Token is sent as Authorization: Bearer
+	Token string `yaml:"token"`
+	// Username and Password are sent with basic authentication
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Headers  map[string]string `yaml:"headers"`
+	// CAFile is a PEM bundle of the CAs trusted for the server certificate, in addition to the
+	// system ones
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM client certificate and key for mutual TLS
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Config is the resolved configuration: each setting comes from the environment, then the
+// profile, then the default. Flags are applied by the commands that define them.
+type Config struct {
+	// EnvFile is the .env file that was loaded, empty if there is none
+	EnvFile string
+	// ProfileName is the name of the selected profile, empty if none is selected
+	ProfileName string
+	// Profile holds the settings of the selected profile as written in the file, the model
+	// settings are resolved per provider by the ai package
+	Profile Profile
+
+	// Backend is BackendHTTP or BackendDirect
+	Backend     string
+	BackendURL  string
+	BackendAuth BackendAuth
+	Namespace   string
+	// KubeContext is the kubeconfig context of the cluster, empty for the current context of
+	// the kubeconfig. It also identifies the cluster to the Kgent API.
+	KubeContext string
+	// Kubeconfig is the kubeconfig file, empty for the default of kubectl and helm
+	Kubeconfig     string
+	MaxLoops       int
+	ModelTimeout   time.Duration
+	BackendTimeout time.Duration
+}
+
+// Active is the configuration of the running command, loaded before it runs
+var Active = Config{
+	Backend:        BackendHTTP,
+	BackendURL:     DefaultBackendURL,
+	MaxLoops:       DefaultMaxLoops,
+	ModelTimeout:   DefaultModelTimeout,
+	BackendTimeout: DefaultBackendTimeout,
+}
+
+// loadEnvFile loads the .env file of the working directory into the environment, without
+// overriding variables that are already set. It returns the path of the file, or an empty
+// path if there is none.
+func loadEnvFile() (string, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	envPath := filepath.Join(workDir, ".env")
+	if _, err := os.Stat(envPath); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err := godotenv.Load(envPath); err != nil {
+		return envPath, fmt.Errorf("failed to load %s: %w", envPath, err)
+	}
+	return envPath, nil
+}
+
+// Path returns the location of the config file, set with KGENT_CONFIG
+func Path() string {
+	if file := utils.GetEnv("KGENT_CONFIG", ""); file != "" {
+		return file
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "kgent", "config.yaml")
+}
+
+// LoadFile reads the config file at path. A missing file is an empty configuration.
+func LoadFile(path string) (*File, error) {
+	file := &File{}
+	if path == "" {
+		return file, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Load loads the .env file and resolves the configuration with the named profile. Without a
+// name the profile is taken from KGENT_PROFILE, then from default_profile of the config file.
+func Load(profileName string) (Config, error) {
+	envFile, err := loadEnvFile()
+	if err != nil {
+		return Config{}, err
+	}
+
+	path := Path()
+	file, err := LoadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if profileName == "" {
+		profileName = utils.GetEnv("KGENT_PROFILE", file.DefaultProfile)
+	}
+	var profile Profile
+	if profileName != "" {
+		var ok bool
+		if profile, ok = file.Profiles[profileName]; !ok {
+			return Config{}, fmt.Errorf("profile %q is not defined in %s (profiles: %s)", profileName, path, file.names())
+		}
+	}
+
+	cfg := Config{
+		EnvFile:     envFile,
+		ProfileName: profileName,
+		Profile:     profile,
+		Backend:     utils.GetEnv("KGENT_BACKEND", cmp.Or(profile.Backend, BackendHTTP)),
+		BackendURL:  utils.GetEnv("KGENT_API_URL", cmp.Or(profile.BackendURL, DefaultBackendURL)),
+		Namespace:   utils.GetEnv("KGENT_NAMESPACE", profile.Namespace),
+		KubeContext: utils.GetEnv("KGENT_CONTEXT", profile.Context),
+		Kubeconfig:  expandHome(profile.Kubeconfig),
+	}
+	// kubectl and helm read KUBECONFIG themselves, and --kubeconfig does not accept its list
+	// of files, so the variable takes precedence by not forwarding the profile file
+	if utils.GetEnv("KUBECONFIG", "") != "" {
+		cfg.Kubeconfig = ""
+	}
+	if err := CheckBackend(cfg.Backend); err != nil {
+		return Config{}, err
+	}
+	cfg.BackendAuth = BackendAuth{
+		Token:    utils.GetEnv("KGENT_API_TOKEN", profile.BackendAuth.Token),
+		Username: utils.GetEnv("KGENT_API_USERNAME", profile.BackendAuth.Username),
+		Password: utils.GetEnv("KGENT_API_PASSWORD", profile.BackendAuth.Password),
+		Headers:  profile.BackendAuth.Headers,
+		CAFile:   expandHome(utils.GetEnv("KGENT_API_CA_FILE", profile.BackendAuth.CAFile)),
+		CertFile: expandHome(utils.GetEnv("KGENT_API_CERT_FILE", profile.BackendAuth.CertFile)),
+		KeyFile:  expandHome(utils.GetEnv("KGENT_API_KEY_FILE", profile.BackendAuth.KeyFile)),
+	}
+	if err := cfg.BackendAuth.check(); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxLoops, err = envInt("KGENT_MAX_LOOPS", cmp.Or(profile.MaxLoops, DefaultMaxLoops)); err != nil {
+		return Config{}, err
+	}
+	if cfg.ModelTimeout, err = envDuration("KGENT_MODEL_TIMEOUT", cmp.Or(profile.ModelTimeout, DefaultModelTimeout)); err != nil {
+		return Config{}, err
+	}
+	if cfg.BackendTimeout, err = envDuration("KGENT_BACKEND_TIMEOUT", cmp.Or(profile.BackendTimeout, DefaultBackendTimeout)); err != nil {
+		return Config{}, err
+	}
+	if cfg.ModelTimeout < 0 || cfg.BackendTimeout < 0 {
+		return Config{}, errors.New("invalid profile: model_timeout and backend_timeout must be positive")
+	}
+	return cfg, nil
+}
+
+// CheckBackend returns an error if backend is not http or direct
+func CheckBackend(backend string) error {
+	if backend != BackendHTTP && backend != BackendDirect {
+		return fmt.Errorf("invalid backend %q, use %s or %s", backend, BackendHTTP, BackendDirect)
+	}
+	return nil
+}
+
+// check returns an error if the credentials contradict each other
+func (a BackendAuth) check() error {
+	if a.Token != "" && a.Username != "" {
+		return errors.New("invalid backend_auth: set either a token or a username, not both")
+	}
+	if a.Password != "" && a.Username == "" {
+		return errors.New("invalid backend_auth: a password needs a username")
+	}
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		return errors.New("invalid backend_auth: cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// names returns the sorted profile names of the file
+func (f *File) names() string {
+	if len(f.Profiles) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// expandHome replaces a leading ~ of path with the home directory, as no shell expands it
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// envInt reads an integer from the environment
+func envInt(key string, fallback int) (int, error) {
+	value := utils.GetEnv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return n, nil
+}
+
+// envDuration reads a positive duration such as 45s from the environment
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := utils.GetEnv(key, "")
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: the duration must be positive", key, value)
+	}
+	return d, nil
+}
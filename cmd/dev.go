@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"kgent/cmd/mockllm"
+	"kgent/cmd/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// devCmd groups the tools for developing and testing kgent
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Tools for developing and testing kgent",
+}
+
+// devMockLLMCmd serves canned model responses
+var devMockLLMCmd = &cobra.Command{
+	Use:   "mock-llm",
+	Short: "Serve an OpenAI compatible model API with canned responses",
+	Long: `Serve an OpenAI compatible /chat/completions endpoint whose responses come from a
+script file, so the chat and check loops can run without a real model. Point
+DASH_SCOPE_URL at the printed URL.
+
+The script is a JSON file with rules matched against the last message of a request,
+in order, responses served in order to the requests no rule matches, and a default
+reply once the responses are used up:
+
+  {
+    "rules": [
+      {"match": "(?m)^Observation:", "role": "user", "reply": "Thought: done\nFinal Answer: Done."},
+      {"match": "New input: (?i)list (\\w+)", "reply": "Thought: list them\nAction: ListTool\nAction Input: {\"resource\": \"$1\"}"}
+    ],
+    "responses": ["Final Answer: Hello!"],
+    "default": {"content": "rate limited", "status": 429}
+  }
+
+A reply is a string or an object with content, tool_calls ([{"name", "arguments"}])
+and status, which makes the server fail with that HTTP status.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		scriptFile, _ := cmd.Flags().GetString("script")
+		addr, _ := cmd.Flags().GetString("addr")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		script, err := mockllm.LoadScript(scriptFile)
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+		handler, err := mockllm.NewServer(script)
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+		if !quiet {
+			handler.Logf = func(format string, args ...interface{}) {
+				utils.PrintCyan(format, args...)
+			}
+		}
+
+		server := &http.Server{Addr: addr, Handler: handler}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		utils.PrintGreen("Mock model API listening, use DASH_SCOPE_URL=http://%s/v1", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devCmd)
+	devCmd.AddCommand(devMockLLMCmd)
+
+	devMockLLMCmd.Flags().StringP("script", "s", "", "Script file with the canned responses")
+	devMockLLMCmd.Flags().String("addr", "127.0.0.1:8089", "Address to listen on")
+	devMockLLMCmd.Flags().BoolP("quiet", "q", false, "Do not log the requests")
+	devMockLLMCmd.MarkFlagRequired("script")
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kgent/cmd/ai"
+	"kgent/cmd/backend"
+	"kgent/cmd/config"
+	"kgent/cmd/tools"
+	"kgent/cmd/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// Status of a diagnostic check
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// doctorTimeout limits each check that reaches the network or runs a command
+const doctorTimeout = 15 * time.Second
+
+// diagnostic is a row of the doctor table
+type diagnostic struct {
+	check  string
+	status string
+	detail string
+}
+
+// doctorCmd checks the configuration and the services kgent depends on
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration and the services kgent depends on",
+	Long: `Check the model credentials and that the model API answers, that the Kgent API is
+healthy, that kubectl and helm are installed and which kubeconfig context is used.
+The command exits with status 1 if a check failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var diagnostics []diagnostic
+		diagnostics = append(diagnostics, configDiagnostics()...)
+		diagnostics = append(diagnostics, modelDiagnostics()...)
+		diagnostics = append(diagnostics, backendDiagnostic())
+		diagnostics = append(diagnostics, toolDiagnostics()...)
+
+		// The status is padded by hand, as tabwriter counts the color codes in the width
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tSTATUS  DETAILS")
+		failed := false
+		for _, d := range diagnostics {
+			fmt.Fprintf(w, "%s\t%s%s  %s\n", d.check, colorizeStatus(d.status), strings.Repeat(" ", len("STATUS")-len(d.status)), d.detail)
+			failed = failed || d.status == checkFail
+		}
+		w.Flush()
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// configDiagnostics describes where the configuration comes from
+func configDiagnostics() []diagnostic {
+	envFile := diagnostic{check: ".env file", status: checkOK, detail: "none, using the environment"}
+	if config.Active.EnvFile != "" {
+		envFile.detail = config.Active.EnvFile
+	}
+
+	profile := diagnostic{check: "Profile", status: checkOK, detail: "none"}
+	if config.Active.ProfileName != "" {
+		profile.detail = fmt.Sprintf("%s (%s)", config.Active.ProfileName, config.Path())
+	}
+	return []diagnostic{envFile, profile}
+}
+
+// modelDiagnostics checks the credentials of the model providers and that each model answers
+func modelDiagnostics() []diagnostic {
+	if err := ai.Setup(config.Active.Profile); err != nil {
+		return []diagnostic{
+			{check: "LLM credentials", status: checkFail, detail: err.Error()},
+			{check: "LLM reachable", status: checkSkip, detail: "no valid model configuration"},
+		}
+	}
+
+	diagnostics := []diagnostic{{check: "LLM credentials", status: checkOK, detail: "provider " + ai.ActiveProvider.Name()}}
+	checked := map[string]bool{}
+	for _, role := range ai.ModelRoles {
+		model := ai.ModelFor(role)
+		if checked[model] {
+			continue
+		}
+		checked[model] = true
+
+		d := diagnostic{check: fmt.Sprintf("LLM %s", role), status: checkOK}
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		start := time.Now()
+		err := ai.Ping(ctx, role)
+		cancel()
+		if err != nil {
+			d.status, d.detail = checkFail, fmt.Sprintf("%s: %v", model, err)
+		} else {
+			d.detail = fmt.Sprintf("%s answered in %s", model, time.Since(start).Round(time.Millisecond))
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// backendDiagnostic checks the health endpoint of the Kgent API, or that the kubeconfig can be
+// loaded in direct mode
+func backendDiagnostic() diagnostic {
+	if config.Active.Backend == config.BackendDirect {
+		if _, err := backend.ResourcesFromConfig(); err != nil {
+			return diagnostic{check: "Kgent API", status: checkFail, detail: err.Error()}
+		}
+		return diagnostic{check: "Kgent API", status: checkSkip, detail: "direct mode, the tools call the Kubernetes API"}
+	}
+	client, err := backend.FromConfig()
+	if err != nil {
+		return diagnostic{check: "Kgent API", status: checkFail, detail: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	if err := client.Health(ctx); err != nil {
+		return diagnostic{check: "Kgent API", status: checkFail, detail: fmt.Sprintf("%s: %v", client.HealthURL(), err)}
+	}
+	return diagnostic{check: "Kgent API", status: checkOK, detail: client.HealthURL()}
+}
+
+// toolDiagnostics checks the command line tools used by KubeTool and the kubeconfig context
+func toolDiagnostics() []diagnostic {
+	kubectl := commandDiagnostic("kubectl", "version", "--client")
+	helm := commandDiagnostic("helm", "version", "--short")
+
+	return []diagnostic{kubectl, helm, contextDiagnostic(kubectl.status == checkOK)}
+}
+
+// contextDiagnostic checks that the selected kubeconfig context exists, or shows the current
+// context of the kubeconfig
+func contextDiagnostic(haveKubectl bool) diagnostic {
+	d := diagnostic{check: "kubeconfig context"}
+	if !haveKubectl {
+		d.status, d.detail = checkSkip, "kubectl is not available"
+		return d
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	if name := config.Active.KubeContext; name != "" {
+		if err := tools.CheckContext(ctx, name); err != nil {
+			d.status, d.detail = checkFail, err.Error()
+			return d
+		}
+		d.status, d.detail = checkOK, name+" (selected)"
+		return d
+	}
+
+	name, err := tools.CurrentContext(ctx)
+	if err != nil {
+		d.status, d.detail = checkWarn, err.Error()
+		return d
+	}
+	d.status, d.detail = checkOK, name+" (current context)"
+	return d
+}
+
+// commandDiagnostic checks that a command is installed and prints its version
+func commandDiagnostic(name string, versionArgs ...string) diagnostic {
+	d := diagnostic{check: name}
+	if _, err := exec.LookPath(name); err != nil {
+		d.status, d.detail = checkWarn, fmt.Sprintf("%s was not found in PATH, KubeTool cannot run %s commands", name, name)
+		return d
+	}
+
+	output, err := runDoctorCommand(name, versionArgs...)
+	if err != nil {
+		d.status, d.detail = checkWarn, err.Error()
+		return d
+	}
+	d.status, d.detail = checkOK, output
+	return d
+}
+
+// runDoctorCommand runs a command and returns the first line of its output
+func runDoctorCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if err != nil {
+		if line != "" {
+			return "", fmt.Errorf("%s: %s", err, line)
+		}
+		return "", err
+	}
+	return line, nil
+}
+
+// colorizeStatus colors the status of a check
+func colorizeStatus(status string) string {
+	switch status {
+	case checkOK:
+		return utils.ColorizeText(utils.Green, status)
+	case checkWarn:
+		return utils.ColorizeText(utils.Yellow, status)
+	case checkFail:
+		return utils.ColorizeText(utils.Red, status)
+	default:
+		return status
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// lineReader reads the user input line by line in the background, so that a read waiting in
+// a turn can be abandoned when the turn is interrupted. The line typed next is then returned
+// by the following read, e.g. at the prompt of the chat loop.
+type lineReader struct {
+	lines chan string
+	// err is the error that ended the input, set before lines is closed
+	err error
+}
+
+// newLineReader starts reading the lines of r
+func newLineReader(r io.Reader) *lineReader {
+	lr := &lineReader{lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lr.lines <- scanner.Text()
+		}
+		lr.err = scanner.Err()
+		close(lr.lines)
+	}()
+	return lr
+}
+
+// readLine returns the next line of the input. It returns io.EOF at the end of the input, and
+// the error of ctx if ctx is done before a line is typed.
+func (lr *lineReader) readLine(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case line, ok := <-lr.lines:
+		if !ok {
+			if lr.err != nil {
+				return "", lr.err
+			}
+			return "", io.EOF
+		}
+		return line, nil
+	}
+}
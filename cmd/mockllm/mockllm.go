@@ -0,0 +1,307 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Script drives the responses of the mock server. A request gets the reply of the first rule
+// matching its last message, otherwise the next of Responses. Once they are all served the
+// Default reply is returned, or the last response again if there is no default.
+type Script struct {
+	Rules     []Rule  `json:"rules"`
+	Responses []Reply `json:"responses"`
+	Default   *Reply  `json:"default"`
+}
+
+// Rule replies to the requests whose last message matches a pattern
+type Rule struct {
+	// Match is a regular expression matched against the content of the last message
+	Match string `json:"match"`
+	// Role restricts the rule to last messages of this role, e.g. user or tool
+	Role string `json:"role,omitempty"`
+	// Reply is the response, its content and arguments may use the submatches as $1 or ${name}
+	Reply Reply `json:"reply"`
+
+	re *regexp.Regexp
+}
+
+// Reply is a canned response. In a script it is either a string, the content of the response,
+// or an object.
+type Reply struct {
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Status makes the server fail with this HTTP status and Content as the error message
+	Status int `json:"status,omitempty"`
+}
+
+// ToolCall is a native tool call of a reply
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// UnmarshalJSON accepts a plain string as the content of the reply
+func (r *Reply) UnmarshalJSON(data []byte) error {
+	var content string
+	if err := json.Unmarshal(data, &content); err == nil {
+		*r = Reply{Content: content}
+		return nil
+	}
+
+	type reply Reply
+	return json.Unmarshal(data, (*reply)(r))
+}
+
+// LoadScript reads a script file
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse script %s: %w", path, err)
+	}
+	return &script, nil
+}
+
+// Server serves an OpenAI compatible chat completion endpoint driven by a script
+type Server struct {
+	// Logf, if set, is called for every request with the reply that was chosen
+	Logf func(format string, args ...interface{})
+
+	script *Script
+	mu     sync.Mutex
+	next   int
+}
+
+// NewServer creates a server for the script
+func NewServer(script *Script) (*Server, error) {
+	if len(script.Rules) == 0 && len(script.Responses) == 0 && script.Default == nil {
+		return nil, fmt.Errorf("the script has no rules, responses or default reply")
+	}
+	for i := range script.Rules {
+		re, err := regexp.Compile(script.Rules[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid pattern: %w", i+1, err)
+		}
+		script.Rules[i].re = re
+	}
+	return &Server{script: script}, nil
+}
+
+// ServeHTTP answers POST requests to any path ending in /chat/completions, so the server
+// works with base URLs with or without /v1
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "the request has no messages")
+		return
+	}
+
+	last := req.Messages[len(req.Messages)-1]
+	reply, source := s.reply(last)
+	if s.Logf != nil {
+		s.Logf("%s %s (%d messages, last from %s) -> %s", r.Method, r.URL.Path, len(req.Messages), last.Role, source)
+	}
+
+	if reply.Status >= 400 {
+		writeError(w, reply.Status, reply.Content)
+		return
+	}
+	if req.Stream {
+		writeStream(w, req, reply)
+		return
+	}
+	writeJSON(w, http.StatusOK, newResponse(req, reply))
+}
+
+// reply picks the reply of a request whose last message is last, and describes where it
+// comes from
+func (s *Server) reply(last openai.ChatCompletionMessage) (Reply, string) {
+	for i, rule := range s.script.Rules {
+		if rule.Role != "" && rule.Role != last.Role {
+			continue
+		}
+		if match := rule.re.FindStringSubmatchIndex(last.Content); match != nil {
+			return rule.expand(last.Content, match), fmt.Sprintf("rule %d", i+1)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next < len(s.script.Responses) {
+		s.next++
+		return s.script.Responses[s.next-1], fmt.Sprintf("response %d", s.next)
+	}
+	if s.script.Default != nil {
+		return *s.script.Default, "default"
+	}
+	if len(s.script.Responses) > 0 {
+		return s.script.Responses[len(s.script.Responses)-1], fmt.Sprintf("response %d", len(s.script.Responses))
+	}
+	return Reply{Status: http.StatusNotFound, Content: "the script has no reply for the request"}, "no reply"
+}
+
+// expand replaces the submatch references of the reply of the rule
+func (r Rule) expand(content string, match []int) Reply {
+	expand := func(template string) string {
+		return string(r.re.ExpandString(nil, template, content, match))
+	}
+
+	reply := Reply{Content: expand(r.Reply.Content), Status: r.Reply.Status}
+	for _, call := range r.Reply.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+			Name:      call.Name,
+			Arguments: json.RawMessage(expand(string(call.Arguments))),
+		})
+	}
+	return reply
+}
+
+// newResponse builds the completion response of a reply
+func newResponse(req openai.ChatCompletionRequest, reply Reply) openai.ChatCompletionResponse {
+	finishReason := openai.FinishReasonStop
+	if len(reply.ToolCalls) > 0 {
+		finishReason = openai.FinishReasonToolCalls
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:      fmt.Sprintf("mock-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   reply.Content,
+				ToolCalls: reply.openAIToolCalls(),
+			},
+			FinishReason: finishReason,
+		}},
+		Usage: usage(req, reply),
+	}
+}
+
+// writeStream sends the reply as server-sent events, the content split in lines so clients
+// see it arrive in several chunks
+func writeStream(w http.ResponseWriter, req openai.ChatCompletionRequest, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	id := fmt.Sprintf("mock-%d", time.Now().UnixNano())
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason, u *openai.Usage) {
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+			Usage:   u,
+		}
+		if u == nil {
+			chunk.Choices = []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finishReason}}
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	send(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "", nil)
+	for _, line := range strings.SplitAfter(reply.Content, "\n") {
+		if line != "" {
+			send(openai.ChatCompletionStreamChoiceDelta{Content: line}, "", nil)
+		}
+	}
+
+	finishReason := openai.FinishReasonStop
+	if calls := reply.openAIToolCalls(); len(calls) > 0 {
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: calls}, "", nil)
+		finishReason = openai.FinishReasonToolCalls
+	}
+	send(openai.ChatCompletionStreamChoiceDelta{}, finishReason, nil)
+
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		u := usage(req, reply)
+		send(openai.ChatCompletionStreamChoiceDelta{}, "", &u)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// openAIToolCalls converts the tool calls of the reply
+func (r Reply) openAIToolCalls() []openai.ToolCall {
+	var calls []openai.ToolCall
+	for i, call := range r.ToolCalls {
+		index := i
+		arguments := string(call.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		calls = append(calls, openai.ToolCall{
+			Index: &index,
+			ID:    fmt.Sprintf("call_%d", i),
+			Type:  openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+	return calls
+}
+
+// usage estimates the token usage of a reply at about four characters per token
+func usage(req openai.ChatCompletionRequest, reply Reply) openai.Usage {
+	var prompt int
+	for _, msg := range req.Messages {
+		prompt += len(msg.Content)/4 + 1
+	}
+	completion := len(reply.Content)/4 + 1
+	for _, call := range reply.ToolCalls {
+		completion += (len(call.Name)+len(call.Arguments))/4 + 1
+	}
+	return openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// writeError sends an error in the format of the OpenAI API
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "mock_error",
+			"code":    status,
+		},
+	})
+}
+
+// writeJSON sends v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
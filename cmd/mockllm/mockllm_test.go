@@ -0,0 +1,249 @@
+package mockllm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// testScript has two rules for the same message, a role-restricted rule, two responses and a
+// default reply
+const testScript = `{
+  "rules": [
+    {"match": "(?m)^Observation: (\\S+)", "role": "user", "reply": "Final Answer: got $1"},
+    {"match": "delete pod (?P<pod>\\S+)", "reply": {"tool_calls": [{"name": "DeleteTool", "arguments": {"resource": "pod", "name": "${pod}"}}]}},
+    {"match": "delete", "reply": "never used, the rule above matches first"},
+    {"match": "fail", "reply": {"status": 503, "content": "overloaded"}},
+    {"match": "from a tool", "role": "tool", "reply": "tool rule"}
+  ],
+  "responses": ["first", "second"],
+  "default": "default reply"
+}`
+
+func newTestServer(t *testing.T, script string) *Server {
+	t.Helper()
+	var s Script
+	if err := json.Unmarshal([]byte(script), &s); err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// complete sends a non-streamed request with a single message and returns the response
+func complete(t *testing.T, server *Server, role string, content string) (int, openai.ChatCompletionResponse, string) {
+	t.Helper()
+	body, _ := json.Marshal(openai.ChatCompletionRequest{
+		Model:    "mock",
+		Messages: []openai.ChatCompletionMessage{{Role: role, Content: content}},
+	})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(body))))
+
+	var rsp openai.ChatCompletionResponse
+	json.Unmarshal(rec.Body.Bytes(), &rsp)
+	return rec.Code, rsp, rec.Body.String()
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string
+		content   string
+		want      string
+		wantCalls string
+	}{
+		{name: "submatch", role: "user", content: "Observation: web-1", want: "Final Answer: got web-1"},
+		{name: "first matching rule wins", role: "user", content: "delete pod web", wantCalls: `DeleteTool {"name":"web","resource":"pod"}`},
+		{name: "role of the rule", role: "tool", content: "from a tool", want: "tool rule"},
+		{name: "rule of another role is skipped", role: "tool", content: "Observation: web-1", want: "first"},
+	}
+
+	server := newTestServer(t, testScript)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, rsp, body := complete(t, server, tt.role, tt.content)
+			if status != http.StatusOK || len(rsp.Choices) != 1 {
+				t.Fatalf("status %d, body %s", status, body)
+			}
+			msg := rsp.Choices[0].Message
+			if msg.Content != tt.want {
+				t.Errorf("content = %q, want %q", msg.Content, tt.want)
+			}
+
+			var calls []string
+			for _, call := range msg.ToolCalls {
+				var args interface{}
+				json.Unmarshal([]byte(call.Function.Arguments), &args)
+				compact, _ := json.Marshal(args)
+				calls = append(calls, call.Function.Name+" "+string(compact))
+			}
+			if got := strings.Join(calls, ", "); got != tt.wantCalls {
+				t.Errorf("tool calls = %q, want %q", got, tt.wantCalls)
+			}
+			if tt.wantCalls != "" && rsp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+				t.Errorf("finish reason = %q, want tool_calls", rsp.Choices[0].FinishReason)
+			}
+		})
+	}
+}
+
+func TestResponsesAndDefault(t *testing.T) {
+	server := newTestServer(t, testScript)
+	for i, want := range []string{"first", "second", "default reply", "default reply"} {
+		_, rsp, body := complete(t, server, "user", "no rule matches")
+		if len(rsp.Choices) != 1 || rsp.Choices[0].Message.Content != want {
+			t.Errorf("request %d: got %s, want %q", i+1, body, want)
+		}
+	}
+
+	// Without a default reply the last response is repeated
+	server = newTestServer(t, `{"responses": ["only"]}`)
+	for i := 0; i < 2; i++ {
+		if _, rsp, body := complete(t, server, "user", "hi"); len(rsp.Choices) != 1 || rsp.Choices[0].Message.Content != "only" {
+			t.Errorf("request %d: got %s, want only", i+1, body)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newTestServer(t, testScript)
+	status, _, body := complete(t, server, "user", "fail")
+	if status != http.StatusServiceUnavailable || !strings.Contains(body, `"message":"overloaded"`) {
+		t.Errorf("status %d, body %s, want 503 with the message", status, body)
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader("{}")))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path: status %d, want 404", rec.Code)
+	}
+
+	if _, err := NewServer(&Script{}); err == nil {
+		t.Error("NewServer accepted an empty script")
+	}
+	if _, err := NewServer(&Script{Rules: []Rule{{Match: "("}}}); err == nil {
+		t.Error("NewServer accepted an invalid pattern")
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := newTestServer(t, `{"default": {"content": "Thought: list\nAction: ListTool", "tool_calls": [{"name": "ListTool", "arguments": {"resource": "pod"}}]}}`)
+	body, _ := json.Marshal(openai.ChatCompletionRequest{
+		Model:         "mock",
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		Messages:      []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(string(body))))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Every event is a data line followed by an empty line, the last one is [DONE]
+	var events []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			t.Fatalf("unexpected line %q", line)
+		}
+		events = append(events, data)
+		if !scanner.Scan() || scanner.Text() != "" {
+			t.Fatalf("event %q is not followed by an empty line", data)
+		}
+	}
+	if len(events) == 0 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("events = %q, want [DONE] last", events)
+	}
+
+	var content strings.Builder
+	var role, tool string
+	var finish openai.FinishReason
+	var usage *openai.Usage
+	for _, event := range events[:len(events)-1] {
+		var chunk openai.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(event), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", event, err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		role += delta.Role
+		content.WriteString(delta.Content)
+		for _, call := range delta.ToolCalls {
+			tool += call.Function.Name + call.Function.Arguments
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			finish = chunk.Choices[0].FinishReason
+		}
+	}
+
+	if role != openai.ChatMessageRoleAssistant {
+		t.Errorf("role = %q, want assistant in the first chunk", role)
+	}
+	if content.String() != "Thought: list\nAction: ListTool" {
+		t.Errorf("content = %q", content.String())
+	}
+	if tool != `ListTool{"resource": "pod"}` {
+		t.Errorf("tool calls = %q", tool)
+	}
+	if finish != openai.FinishReasonToolCalls {
+		t.Errorf("finish reason = %q, want tool_calls", finish)
+	}
+	if usage == nil || usage.TotalTokens == 0 {
+		t.Errorf("usage = %+v, want a usage chunk", usage)
+	}
+}
+
+// TestStreamClient reads a stream with the OpenAI client, as kgent does
+func TestStreamClient(t *testing.T) {
+	httpServer := httptest.NewServer(newTestServer(t, `{"default": "line one\nline two"}`))
+	defer httpServer.Close()
+
+	cfg := openai.DefaultConfig("mock")
+	cfg.BaseURL = httpServer.URL + "/v1"
+	stream, err := openai.NewClientWithConfig(cfg).CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:    "mock",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	chunks := 0
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks++
+		if len(chunk.Choices) > 0 {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if content.String() != "line one\nline two" || chunks < 3 {
+		t.Errorf("got %q in %d chunks, want both lines in several chunks", content.String(), chunks)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"kgent/cmd/ai"
+	"kgent/cmd/session"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of one-shot mode
+const (
+	exitOK = iota
+	// exitFailed means the turn failed, e.g. because the model could not be reached
+	exitFailed
+	// exitUsage means the command line was invalid
+	exitUsage
+	// exitNoAnswer means the model did not reach a final answer within the loop limit
+	exitNoAnswer
+)
+
+// maxLoopsError is recorded on turns that reach the loop limit without an answer
+const maxLoopsError = "Exceeded maximum number of reasoning loops"
+
+// tokenBudgetError is recorded on turns stopped by --max-tokens-budget
+const tokenBudgetError = "Exceeded the token budget"
+
+// oneShotResult is the JSON document printed by one-shot mode with --output json
+type oneShotResult struct {
+	Session   string             `json:"session"`
+	Query     string             `json:"query"`
+	Answer    string             `json:"answer"`
+	ToolCalls []session.ToolCall `json:"toolCalls"`
+	Error     string             `json:"error,omitempty"`
+	Usage     ai.Usage           `json:"usage"`
+}
+
+// stdinQuery is the value of --query that reads the query from stdin
+const stdinQuery = "-"
+
+// oneShotQuery returns the query of one-shot mode from the --query flag, or from stdin with
+// --query -. An empty query means the command runs interactively, reading the requests
+// from stdin even if it is not a terminal.
+func oneShotQuery(cmd *cobra.Command) (string, error) {
+	query, _ := cmd.Flags().GetString("query")
+	if query != stdinQuery {
+		return query, nil
+	}
+
+	data, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return "", fmt.Errorf("failed to read the query from stdin: %w", err)
+	}
+	query = strings.TrimSpace(string(data))
+	if query == "" {
+		return "", fmt.Errorf("no query on stdin for --query %s", stdinQuery)
+	}
+	return query, nil
+}
+
+// runOnce answers a single query, prints only the answer in the requested format and
+// returns the exit code of the command
+func (a *agent) runOnce(query string, output string) int {
+	if output != "text" && output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported output format %q, use text or json\n", output)
+		return exitUsage
+	}
+
+	if a.plan {
+		fmt.Fprintln(os.Stderr, "Error: --plan needs an interactive session to review the plan")
+		return exitUsage
+	}
+
+	a.quiet = true
+	a.stream = false
+	t := a.runTurn(a.withNamespace(query))
+
+	if output == "json" {
+		result := oneShotResult{
+			Session:   a.session.ID,
+			Query:     t.Query,
+			Answer:    t.Answer,
+			ToolCalls: t.ToolCalls,
+			Error:     t.Error,
+			Usage:     t.Usage,
+		}
+		if result.ToolCalls == nil {
+			result.ToolCalls = []session.ToolCall{}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFailed
+		}
+	} else if t.Answer != "" {
+		fmt.Println(t.Answer)
+	} else if t.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", t.Error)
+	}
+
+	switch {
+	case t.Answer != "":
+		return exitOK
+	case t.Error == maxLoopsError:
+		return exitNoAnswer
+	default:
+		return exitFailed
+	}
+}
@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Action is a tool invocation requested by the model in the ReAct format
+type Action struct {
+	Name  string
+	Input json.RawMessage
+}
+
+// Response is the parsed content of a ReAct response
+type Response struct {
+	Thought     string
+	Actions     []Action
+	FinalAnswer string
+	// HasFinalAnswer is set when the response contains a "Final Answer:" section
+	HasFinalAnswer bool
+	// Observation holds an "Observation:" section the model wrote itself instead of waiting
+	// for the tool result, along with everything that follows it
+	Observation string
+	// Cleaned is the response without the made-up observation
+	Cleaned string
+}
+
+// ParseError describes why a response does not follow the ReAct format
+type ParseError struct {
+	// Action is the name of the action whose input could not be parsed, if any
+	Action string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Action != "" {
+		return fmt.Sprintf("invalid Action Input for %s: %s", e.Action, e.Reason)
+	}
+	return e.Reason
+}
+
+var (
+	thoughtPattern     = regexp.MustCompile(`(?m)^[ \t*]*Thought:[ \t]*(.*)$`)
+	actionPattern      = regexp.MustCompile(`(?m)^[ \t*]*Action:[ \t]*(.*)$`)
+	actionInputPattern = regexp.MustCompile(`(?m)^[ \t*]*Action Input:[ \t]*`)
+	observationPattern = regexp.MustCompile(`(?m)^[ \t*]*Observation:`)
+	finalAnswerPattern = regexp.MustCompile(`(?m)^[ \t*]*Final Answer:[ \t]*`)
+	// sectionPattern matches the start of any section that ends an Action Input
+	sectionPattern = regexp.MustCompile(`(?m)^[ \t*]*(?:Thought|Action|Observation|Final Answer|Pause):`)
+	fencePattern   = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n?(.*?)```")
+)
+
+// Parse extracts the thought, the actions and the final answer of a ReAct response. It accepts
+// multi-line and code-fenced JSON inputs, repairs common JSON mistakes and cuts off any
+// observation the model made up. A response whose actions cannot be parsed, or that contains
+// neither an action nor a final answer, returns a *ParseError along with what could be parsed.
+func Parse(content string) (*Response, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	rsp := &Response{Cleaned: content}
+
+	if loc := observationPattern.FindStringIndex(content); loc != nil {
+		rsp.Observation = strings.TrimSpace(content[loc[0]:])
+		rsp.Cleaned = strings.TrimRight(content[:loc[0]], " \t\n")
+	}
+
+	if m := thoughtPattern.FindStringSubmatch(rsp.Cleaned); m != nil {
+		rsp.Thought = strings.TrimSpace(m[1])
+	}
+
+	// A final answer is searched in the whole content, even after a made-up observation,
+	// so the caller can decide which of a pending action and an answer wins
+	finalLoc := finalAnswerPattern.FindStringIndex(content)
+	if finalLoc != nil {
+		rsp.HasFinalAnswer = true
+		rsp.FinalAnswer = strings.TrimSpace(content[finalLoc[1]:])
+	}
+
+	actions, err := parseActions(rsp.Cleaned)
+	rsp.Actions = actions
+
+	// A final answer written after an action cannot be based on its result
+	if actionLoc := actionPattern.FindStringIndex(rsp.Cleaned); actionLoc != nil && finalLoc != nil &&
+		finalLoc[0] > actionLoc[0] && finalLoc[0] < len(rsp.Cleaned) {
+		rsp.Cleaned = strings.TrimRight(rsp.Cleaned[:finalLoc[0]], " \t\n")
+	}
+
+	if err != nil {
+		return rsp, err
+	}
+	if len(rsp.Actions) == 0 && !rsp.HasFinalAnswer {
+		return rsp, &ParseError{Reason: "the response contains neither an Action with an Action Input nor a Final Answer"}
+	}
+	return rsp, nil
+}
+
+// HasCompleteAction reports whether content already contains an action whose input is a
+// complete JSON object. It is used to stop streaming as soon as an action can be executed.
+func HasCompleteAction(content string) bool {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if loc := observationPattern.FindStringIndex(content); loc != nil {
+		return true
+	}
+	for _, block := range actionBlocks(content) {
+		if _, complete := extractObject(block.input); complete {
+			return true
+		}
+	}
+	return false
+}
+
+// actionBlock is the raw text of one Action / Action Input pair
+type actionBlock struct {
+	name     string
+	input    string
+	hasInput bool
+}
+
+// actionBlocks splits content into its Action / Action Input pairs
+func actionBlocks(content string) []actionBlock {
+	var blocks []actionBlock
+
+	locs := actionPattern.FindAllStringSubmatchIndex(content, -1)
+	for i, loc := range locs {
+		block := actionBlock{name: cleanActionName(content[loc[2]:loc[3]])}
+
+		end := len(content)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		rest := content[loc[1]:end]
+
+		if inputLoc := actionInputPattern.FindStringIndex(rest); inputLoc != nil {
+			block.hasInput = true
+			input := rest[inputLoc[1]:]
+			// The input ends at the next section, unless that section is inside a code fence
+			input = cutAtNextSection(input)
+			block.input = input
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// parseActions parses every Action / Action Input pair of content
+func parseActions(content string) ([]Action, error) {
+	var actions []Action
+	for _, block := range actionBlocks(content) {
+		if block.name == "" {
+			return actions, &ParseError{Reason: "an Action line does not name a tool"}
+		}
+		if !block.hasInput {
+			return actions, &ParseError{Action: block.name, Reason: "the Action Input line is missing"}
+		}
+
+		input, err := parseInput(block.input)
+		if err != nil {
+			return actions, &ParseError{Action: block.name, Reason: err.Error()}
+		}
+		actions = append(actions, Action{Name: block.name, Input: input})
+	}
+	return actions, nil
+}
+
+// cutAtNextSection returns the input up to the next ReAct section outside of a code fence
+func cutAtNextSection(input string) string {
+	offset := 0
+	for {
+		loc := sectionPattern.FindStringIndex(input[offset:])
+		if loc == nil {
+			return input
+		}
+		cut := offset + loc[0]
+		if strings.Count(input[:cut], "```")%2 == 0 {
+			return input[:cut]
+		}
+		offset = offset + loc[1]
+	}
+}
+
+// cleanActionName removes the decoration models add around tool names
+func cleanActionName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.Trim(name, "`\"'[]*. ")
+	// "ListTool(...)" or "ListTool with input" style answers
+	if idx := strings.IndexAny(name, " ("); idx > 0 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// parseInput extracts the JSON object of an Action Input, repairing it if needed
+func parseInput(raw string) (json.RawMessage, error) {
+	raw = strings.TrimSpace(raw)
+	if m := fencePattern.FindStringSubmatch(raw); m != nil {
+		raw = strings.TrimSpace(m[1])
+	}
+	if raw == "" {
+		return nil, fmt.Errorf("the Action Input is empty")
+	}
+
+	obj, complete := extractObject(raw)
+	if obj == "" {
+		return nil, fmt.Errorf("the Action Input is not a JSON object: %q", firstLine(raw))
+	}
+	if complete && json.Valid([]byte(obj)) {
+		return json.RawMessage(obj), nil
+	}
+
+	repaired := Repair(obj)
+	if !json.Valid([]byte(repaired)) {
+		return nil, fmt.Errorf("the Action Input is not valid JSON: %q", firstLine(obj))
+	}
+	return json.RawMessage(repaired), nil
+}
+
+// extractObject returns the first JSON object of s, and whether its braces are balanced.
+// An unbalanced object is returned up to the end of s. Only double quotes delimit strings, as
+// single quotes are far more often apostrophes than quotes.
+func extractObject(s string) (string, bool) {
+	start := strings.Index(s, "{")
+	if start < 0 {
+		return "", false
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i, r := range s[start:] {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+			if depth == 0 {
+				return s[start : start+i+1], true
+			}
+		}
+	}
+	return strings.TrimSpace(s[start:]), false
+}
+
+// firstLine returns the first line of s for error messages
+func firstLine(s string) string {
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx] + "..."
+	}
+	return s
+}
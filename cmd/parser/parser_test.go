@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		thought     string
+		actions     []Action
+		finalAnswer string
+		observation bool
+		wantErr     bool
+	}{
+		{
+			name:    "action",
+			content: "Thought: list the pods\nAction: ListTool\nAction Input: {\"resource\": \"pod\"}",
+			thought: "list the pods",
+			actions: []Action{{Name: "ListTool", Input: []byte(`{"resource": "pod"}`)}},
+		},
+		{
+			name:        "final answer",
+			content:     "Thought: done\nFinal Answer: There are 3 pods.\nAll are running.",
+			thought:     "done",
+			finalAnswer: "There are 3 pods.\nAll are running.",
+		},
+		{
+			name:    "decorated action name",
+			content: "**Action:** `ListTool`\nAction Input: {\"resource\": \"pod\"}",
+			actions: []Action{{Name: "ListTool", Input: []byte(`{"resource": "pod"}`)}},
+		},
+		{
+			name:    "multi-line fenced input",
+			content: "Action: CreateTool\nAction Input:\n```json\n{\n  \"prompt\": \"a pod\",\n  \"resource\": \"pod\"\n}\n```",
+			actions: []Action{{Name: "CreateTool", Input: []byte("{\n  \"prompt\": \"a pod\",\n  \"resource\": \"pod\"\n}")}},
+		},
+		{
+			name:    "apostrophe in a string",
+			content: "Action: HumanTool\nAction Input: {\"prompt\": \"Delete the pod? It's {not} ready\"}",
+			actions: []Action{{Name: "HumanTool", Input: []byte(`{"prompt": "Delete the pod? It's {not} ready"}`)}},
+		},
+		{
+			name:    "repaired input",
+			content: "Action: ListTool\nAction Input: {resource: 'pod', namespace: \"default\",}",
+			actions: []Action{{Name: "ListTool", Input: []byte(`{"resource": "pod", "namespace": "default"}`)}},
+		},
+		{
+			name:    "several actions",
+			content: "Action: ListTool\nAction Input: {\"resource\": \"pod\"}\nAction: ListTool\nAction Input: {\"resource\": \"service\"}",
+			actions: []Action{
+				{Name: "ListTool", Input: []byte(`{"resource": "pod"}`)},
+				{Name: "ListTool", Input: []byte(`{"resource": "service"}`)},
+			},
+		},
+		{
+			name:        "made-up observation",
+			content:     "Action: ListTool\nAction Input: {\"resource\": \"pod\"}\nObservation: web-1\nFinal Answer: web-1",
+			actions:     []Action{{Name: "ListTool", Input: []byte(`{"resource": "pod"}`)}},
+			finalAnswer: "web-1",
+			observation: true,
+		},
+		{
+			name:    "missing input",
+			content: "Action: ListTool",
+			wantErr: true,
+		},
+		{
+			name:    "input is not an object",
+			content: "Action: ListTool\nAction Input: pods",
+			wantErr: true,
+		},
+		{
+			name:    "neither action nor answer",
+			content: "I think the pods are fine.",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp, err := Parse(tt.content)
+			var parseErr *ParseError
+			if tt.wantErr {
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("Parse() error = %v, want a *ParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if rsp.Thought != tt.thought {
+				t.Errorf("Thought = %q, want %q", rsp.Thought, tt.thought)
+			}
+			if rsp.FinalAnswer != tt.finalAnswer {
+				t.Errorf("FinalAnswer = %q, want %q", rsp.FinalAnswer, tt.finalAnswer)
+			}
+			if rsp.HasFinalAnswer != (tt.finalAnswer != "") {
+				t.Errorf("HasFinalAnswer = %v, want %v", rsp.HasFinalAnswer, tt.finalAnswer != "")
+			}
+			if (rsp.Observation != "") != tt.observation {
+				t.Errorf("Observation = %q, want one: %v", rsp.Observation, tt.observation)
+			}
+			if len(rsp.Actions) != len(tt.actions) {
+				t.Fatalf("Actions = %d, want %d", len(rsp.Actions), len(tt.actions))
+			}
+			for i, action := range rsp.Actions {
+				if action.Name != tt.actions[i].Name || string(action.Input) != string(tt.actions[i].Input) {
+					t.Errorf("Actions[%d] = %s %s, want %s %s", i, action.Name, action.Input, tt.actions[i].Name, tt.actions[i].Input)
+				}
+			}
+		})
+	}
+}
+
+func TestHasCompleteAction(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"Thought: list\nAction: ListTool\nAction Input: {\"resource\": \"pod\"}", true},
+		{"Thought: list\nAction: ListTool\nAction Input: {\"resource\": \"po", false},
+		{"Action: HumanTool\nAction Input: {\"prompt\": \"it's a {\"}", true},
+		{"Action: HumanTool\nAction Input: {prompt: it's web}", true},
+		{"Action: ListTool\nAction Input: {\"resource\": \"pod\"\nObservation:", true},
+		{"Thought: I know the answer", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasCompleteAction(tt.content); got != tt.want {
+			t.Errorf("HasCompleteAction(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
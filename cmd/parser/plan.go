@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Step is a single tool call of a plan
+type Step struct {
+	Tool        string          `json:"tool"`
+	Input       json.RawMessage `json:"input"`
+	Description string          `json:"description"`
+}
+
+// Plan is the list of tool calls the model proposes to answer a request. A request that
+// needs no tool is answered directly in Answer.
+type Plan struct {
+	Steps  []Step `json:"steps"`
+	Answer string `json:"answer"`
+}
+
+// ParsePlan extracts the plan from a model response. The plan is a JSON object that may be
+// wrapped in a code fence or surrounded by text, and common JSON mistakes are repaired.
+func ParsePlan(content string) (*Plan, error) {
+	raw := strings.TrimSpace(content)
+	if m := fencePattern.FindStringSubmatch(raw); m != nil {
+		raw = strings.TrimSpace(m[1])
+	}
+
+	obj, complete := extractObject(raw)
+	if obj == "" {
+		return nil, &ParseError{Reason: fmt.Sprintf("the plan is not a JSON object: %q", firstLine(raw))}
+	}
+	if !complete || !json.Valid([]byte(obj)) {
+		obj = Repair(obj)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal([]byte(obj), &plan); err != nil {
+		return nil, &ParseError{Reason: fmt.Sprintf("the plan is not valid JSON: %v", err)}
+	}
+
+	for i, step := range plan.Steps {
+		step.Tool = cleanActionName(step.Tool)
+		if step.Tool == "" {
+			return nil, &ParseError{Reason: fmt.Sprintf("step %d does not name a tool", i+1)}
+		}
+		if len(step.Input) == 0 || string(step.Input) == "null" {
+			step.Input = json.RawMessage("{}")
+		}
+		plan.Steps[i] = step
+	}
+
+	if len(plan.Steps) == 0 && strings.TrimSpace(plan.Answer) == "" {
+		return nil, &ParseError{Reason: "the plan contains neither steps nor an answer"}
+	}
+	return &plan, nil
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	trailingCommaPattern = regexp.MustCompile(`,\s*([}\]])`)
+	unquotedKeyPattern   = regexp.MustCompile(`([{,]\s*)([A-Za-z_][A-Za-z0-9_\-]*)\s*:`)
+)
+
+// Repair fixes the JSON mistakes models commonly make: smart quotes, single-quoted strings,
+// unquoted keys, trailing commas, raw newlines inside strings and missing closing braces.
+// The result is not guaranteed to be valid JSON.
+func Repair(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'").Replace(s)
+	s = normalizeStrings(s)
+	s = outsideStrings(s, func(code string) string {
+		code = unquotedKeyPattern.ReplaceAllString(code, `$1"$2":`)
+		return trailingCommaPattern.ReplaceAllString(code, "$1")
+	})
+	return closeBrackets(s)
+}
+
+// outsideStrings applies fix to the parts of s that are not inside double-quoted strings, so
+// the text of the values is left as the model wrote it
+func outsideStrings(s string, fix func(string) string) string {
+	var b strings.Builder
+	start := 0
+	inString := false
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"' && inString:
+			inString = false
+			b.WriteString(s[start : i+1])
+			start = i + 1
+		case r == '"':
+			inString = true
+			b.WriteString(fix(s[start:i]))
+			start = i
+		}
+	}
+	if inString {
+		b.WriteString(s[start:])
+	} else {
+		b.WriteString(fix(s[start:]))
+	}
+	return b.String()
+}
+
+// normalizeStrings converts single-quoted strings to double-quoted ones and escapes raw
+// control characters inside strings
+func normalizeStrings(s string) string {
+	var b strings.Builder
+	inString := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteRune(r)
+		case inString && r == '\\':
+			escaped = true
+			b.WriteRune(r)
+		case inString && r == quote:
+			inString = false
+			b.WriteRune('"')
+		case inString && r == '"':
+			// a double quote inside a single-quoted string
+			b.WriteString(`\"`)
+		case inString && r == '\n':
+			b.WriteString(`\n`)
+		case inString && r == '\r':
+			b.WriteString(`\r`)
+		case inString && r == '\t':
+			b.WriteString(`\t`)
+		case !inString && (r == '"' || r == '\''):
+			inString = true
+			quote = r
+			b.WriteRune('"')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if inString {
+		b.WriteRune('"')
+	}
+	return b.String()
+}
+
+// closeBrackets appends the closing braces and brackets of an object cut short
+func closeBrackets(s string) string {
+	var stack []rune
+	inString := false
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '{':
+			stack = append(stack, '}')
+		case r == '[':
+			stack = append(stack, ']')
+		case (r == '}' || r == ']') && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	s = strings.TrimRight(s, ", \t\n")
+	for i := len(stack) - 1; i >= 0; i-- {
+		s += string(stack[i])
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "valid JSON",
+			in:   `{"resource": "pod", "namespace": "default"}`,
+			want: `{"resource": "pod", "namespace": "default"}`,
+		},
+		{
+			name: "smart quotes",
+			in:   `{“resource”: “pod”}`,
+			want: `{"resource": "pod"}`,
+		},
+		{
+			name: "single-quoted strings",
+			in:   `{'resource': 'pod', 'prompt': 'say "hi"'}`,
+			want: `{"resource": "pod", "prompt": "say \"hi\""}`,
+		},
+		{
+			name: "unquoted keys",
+			in:   `{resource: "pod", name_space: "default"}`,
+			want: `{"resource": "pod", "name_space": "default"}`,
+		},
+		{
+			name: "trailing commas",
+			in:   `{"names": ["a", "b",], "resource": "pod",}`,
+			want: `{"names": ["a", "b"], "resource": "pod"}`,
+		},
+		{
+			name: "raw newlines in strings",
+			in:   "{\"yaml\": \"kind: Pod\n\tname: web\"}",
+			want: `{"yaml": "kind: Pod\n\tname: web"}`,
+		},
+		{
+			name: "missing closing braces",
+			in:   `{"resource": "pod", "labels": {"app": "web"`,
+			want: `{"resource": "pod", "labels": {"app": "web"}}`,
+		},
+		{
+			name: "unterminated string",
+			in:   `{"prompt": "delete the pod`,
+			want: `{"prompt": "delete the pod"}`,
+		},
+		{
+			name: "key-like text in a string",
+			in:   `{"prompt": "confirm, name: web", "resource": "pod",}`,
+			want: `{"prompt": "confirm, name: web", "resource": "pod"}`,
+		},
+		{
+			name: "comma before a bracket in a string",
+			in:   `{"yaml": "args: [a, ]", key: "x"}`,
+			want: `{"yaml": "args: [a, ]", "key": "x"}`,
+		},
+		{
+			name: "escaped quotes in a string",
+			in:   `{"prompt": "say \"a, b: c\"", name: "web"}`,
+			want: `{"prompt": "say \"a, b: c\"", "name": "web"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Repair(tt.in)
+			if got != tt.want {
+				t.Errorf("Repair(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("Repair(%q) = %q is not valid JSON", tt.in, got)
+			}
+		})
+	}
+}
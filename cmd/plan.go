@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"kgent/cmd/ai"
+	"kgent/cmd/parser"
+	promptTpl "kgent/cmd/prompt"
+	"kgent/cmd/tools"
+	"kgent/cmd/utils"
+)
+
+// maxPlanAttempts is the number of times the model is asked for a plan that can be parsed
+const maxPlanAttempts = 2
+
+// Status of an executed plan step
+const (
+	stepDone    = "done"
+	stepFailed  = "failed"
+	stepSkipped = "skipped"
+)
+
+// stepResult is the outcome of a plan step
+type stepResult struct {
+	step   parser.Step
+	status string
+	output string
+}
+
+// runPlanTurn asks the model for a plan of tool calls, lets the user review it and executes
+// the approved steps before asking the model to report the results
+func (a *agent) runPlanTurn(ctx context.Context) {
+	if !a.checkTokenBudget() {
+		return
+	}
+
+	plan, err := a.requestPlan(ctx)
+	if ctx.Err() != nil {
+		a.interruptTurn()
+		return
+	}
+	if err != nil {
+		a.failTurn("Error creating plan: %v", err)
+		return
+	}
+
+	// Nothing to run, the model answered directly
+	if len(plan.Steps) == 0 {
+		a.turn.Answer = strings.TrimSpace(plan.Answer)
+		a.printFinalAnswer(a.turn.Answer, a.turn.Answer)
+		return
+	}
+
+	steps, approved := a.reviewPlan(ctx, plan.Steps)
+	if ctx.Err() != nil {
+		a.interruptTurn()
+		return
+	}
+	if !approved {
+		a.turn.Answer = "The plan was cancelled, nothing was executed."
+		utils.PrintYellow("%s", a.turn.Answer)
+		return
+	}
+
+	results := a.executePlan(ctx, steps)
+	if ctx.Err() != nil {
+		a.interruptTurn()
+		return
+	}
+	a.reportPlan(ctx, results)
+}
+
+// requestPlan asks the model for a plan, and for a corrected one if it cannot be parsed
+func (a *agent) requestPlan(ctx context.Context) (*parser.Plan, error) {
+	var err error
+	for attempt := 1; attempt <= maxPlanAttempts; attempt++ {
+		ai.MessageStore.Fit(ctx, a.contextBudget, keepRecentMessages)
+		if a.debugMode {
+			fmt.Printf("---------------- Plan attempt %d ----------------\n", attempt)
+			printDebugInfo()
+		} else {
+			utils.PrintCyan("Planning...")
+		}
+
+		response, chatErr := ai.Chat(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage())
+		if chatErr != nil {
+			return nil, chatErr
+		}
+		if a.debugMode {
+			fmt.Println("# Plan from LLM:")
+			fmt.Println(response.Content)
+			fmt.Println()
+		}
+		ai.MessageStore.AddAssistant(response)
+
+		var plan *parser.Plan
+		plan, err = parser.ParsePlan(response.Content)
+		if err == nil {
+			err = a.validatePlan(plan)
+		}
+		if err == nil {
+			return plan, nil
+		}
+
+		ai.MessageStore.AddUser(fmt.Sprintf(promptTpl.PlanCorrectionTemplate, err, a.registry.Names()))
+	}
+	return nil, err
+}
+
+// validatePlan checks that every step uses a registered tool
+func (a *agent) validatePlan(plan *parser.Plan) error {
+	for i, step := range plan.Steps {
+		if _, ok := a.registry.Get(step.Tool); !ok {
+			return fmt.Errorf("step %d uses the unknown tool %s", i+1, step.Tool)
+		}
+	}
+	return nil
+}
+
+// renderPlan prints the steps as a numbered list with the risk of each step
+func (a *agent) renderPlan(steps []parser.Step) {
+	utils.PrintCyan("Plan:")
+	for i, step := range steps {
+		risk := tools.RiskReadOnly
+		if t, ok := a.registry.Get(step.Tool); ok {
+			risk = t.Risk()
+		}
+
+		line := fmt.Sprintf("%2d. [%s] %s: %s", i+1, risk, step.Tool, stepDescription(step))
+		switch risk {
+		case tools.RiskDestructive:
+			utils.PrintRed("%s", line)
+		case tools.RiskChange:
+			utils.PrintYellow("%s", line)
+		default:
+			utils.PrintGreen("%s", line)
+		}
+		fmt.Printf("      %s\n", step.Input)
+	}
+}
+
+// reviewPlan lets the user approve, edit or drop steps and returns the steps to execute,
+// or false if the plan was rejected
+func (a *agent) reviewPlan(ctx context.Context, steps []parser.Step) ([]parser.Step, bool) {
+	for {
+		if len(steps) == 0 {
+			utils.PrintYellow("All steps were dropped.")
+			return nil, false
+		}
+		a.renderPlan(steps)
+
+		utils.PrintYellowNoNewline("Run this plan? [y]es, [n]o, [e]dit <step>, [d]rop <step>: ")
+		answer, ok := a.readLine(ctx)
+		if !ok {
+			return nil, false
+		}
+
+		fields := strings.Fields(answer)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "y", "yes":
+			return steps, true
+		case "n", "no":
+			return nil, false
+		case "d", "drop":
+			i, err := stepIndex(fields, len(steps))
+			if err != nil {
+				utils.PrintRed("Error: %v", err)
+				continue
+			}
+			steps = append(steps[:i], steps[i+1:]...)
+		case "e", "edit":
+			i, err := stepIndex(fields, len(steps))
+			if err != nil {
+				utils.PrintRed("Error: %v", err)
+				continue
+			}
+			a.editStep(ctx, &steps[i], i)
+		default:
+			utils.PrintRed("Unknown answer %q", answer)
+		}
+	}
+}
+
+// editStep replaces the input of a step with one typed by the user
+func (a *agent) editStep(ctx context.Context, step *parser.Step, index int) {
+	fmt.Printf("Current input of step %d: %s\n", index+1, step.Input)
+	utils.PrintYellowNoNewline("New input (JSON, empty to keep): ")
+	line, ok := a.readLine(ctx)
+	line = strings.TrimSpace(line)
+	if !ok || line == "" {
+		return
+	}
+
+	if !json.Valid([]byte(line)) {
+		line = parser.Repair(line)
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &input); err != nil {
+		utils.PrintRed("The input must be a JSON object, step %d was not changed", index+1)
+		return
+	}
+	step.Input = json.RawMessage(line)
+}
+
+// executePlan runs the steps in order and reports the status of each one. The steps after a
+// failed step are skipped, as they usually depend on it.
+func (a *agent) executePlan(ctx context.Context, steps []parser.Step) []stepResult {
+	results := make([]stepResult, 0, len(steps))
+	failed := false
+	for i, step := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+
+		prefix := fmt.Sprintf("[%d/%d]", i+1, len(steps))
+		if failed {
+			utils.PrintYellow("%s skipped: %s", prefix, stepDescription(step))
+			results = append(results, stepResult{step: step, status: stepSkipped})
+			continue
+		}
+
+		utils.PrintCyan("%s %s...", prefix, stepDescription(step))
+		output, err := a.callTool(ctx, step.Tool, string(step.Input))
+		if err != nil {
+			failed = true
+			utils.PrintRed("%s failed: %v", prefix, err)
+			results = append(results, stepResult{step: step, status: stepFailed, output: err.Error()})
+			continue
+		}
+		utils.PrintGreen("%s done", prefix)
+		results = append(results, stepResult{step: step, status: stepDone, output: output})
+	}
+	return results
+}
+
+// reportPlan asks the model to turn the step results into the answer of the turn
+func (a *agent) reportPlan(ctx context.Context, results []stepResult) {
+	var report strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&report, "%d. %s %s => %s", i+1, r.step.Tool, r.step.Input, r.status)
+		if r.output != "" {
+			fmt.Fprintf(&report, ": %s", r.output)
+		}
+		report.WriteString("\n")
+	}
+	ai.MessageStore.AddUser(fmt.Sprintf(promptTpl.PlanResultTemplate, report.String()))
+
+	response, err := ai.Chat(ctx, ai.ModelReasoning, ai.MessageStore.GetMessage())
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// The steps ran anyway, so answer with their status instead of failing the turn
+		utils.PrintYellow("Warning: failed to summarize the results: %v", err)
+		a.turn.Answer = "Plan results:\n" + strings.TrimSpace(report.String())
+	} else {
+		a.turn.Answer = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(response.Content), "Final Answer:"))
+	}
+	a.printFinalAnswer(a.turn.Answer, a.turn.Answer)
+}
+
+// readLine reads a line of user input during a turn, false once the input is closed or the
+// turn is interrupted
+func (a *agent) readLine(ctx context.Context) (string, bool) {
+	if a.input == nil {
+		a.input = newLineReader(os.Stdin)
+	}
+	line, err := a.input.readLine(ctx)
+	return line, err == nil
+}
+
+// stepIndex parses the step number given after an edit or drop answer
+func stepIndex(fields []string, count int) (int, error) {
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("please give a step number, e.g. %s 2", fields[0])
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 1 || n > count {
+		return 0, fmt.Errorf("invalid step %q, choose a step between 1 and %d", fields[1], count)
+	}
+	return n - 1, nil
+}
+
+// stepDescription returns the description of a step, or its tool call if the model gave none
+func stepDescription(step parser.Step) string {
+	if description := strings.TrimSpace(step.Description); description != "" {
+		return description
+	}
+	return fmt.Sprintf("%s %s", step.Tool, step.Input)
+}
@@ -4,6 +4,10 @@ const SystemPrompt = `
 You are a Kubernetes expert. A user will ask you questions about Kubernetes. Please identify the problem and provide a solution. You should always use the available tools to gather accurate data before answering.
 `
 
+const SystemToolsTemplate = `
+The tools available in this conversation are: %s
+`
+
 const Template = `
 IMPORTANT:
 1. If the "Action" is a tool, then don't make up "Observation" and "Final Answer"
@@ -38,6 +42,32 @@ New input: %s
 
 `
 
+const FormatCorrectionTemplate = `
+Your previous response could not be processed: %s.
+
+Please reply again using exactly one of the following formats. The Action Input must be a single valid JSON object.
+
+Thought: Do I need to use a tool? Yes
+Action: the action to take, should be one of %s
+Action Input: {"key": "value"}
+
+or
+
+Thought: Do I need to use a tool? No
+Final Answer: [your response here]
+`
+
+const ToolCallingTemplate = `
+IMPORTANT:
+1. Call the provided tools whenever you need data from the cluster or need to change it, and wait for their results
+2. For ANY deletion operation, you MUST first use HumanTool to get confirmation
+3. ONLY use DeleteTool AFTER receiving explicit confirmation through HumanTool
+4. When you have a response to say to the Human, answer directly without calling a tool
+
+New input: %s
+
+`
+
 const K8sAssistantPrompt = `
 You are a Kubernetes expert. Generate valid Kubernetes resource definitions based on user requirements.
 
@@ -50,3 +80,47 @@ Output guidelines:
 - ALWAYS output the namespace in the YAML file
 
 `
+
+const SummarizePrompt = `
+You are compressing part of a conversation between a user and a Kubernetes assistant to save context space.
+Summarize the following message in a few sentences. Keep every resource name, namespace, kind, status, error message and number that could matter for follow-up questions. Drop everything else.
+Output ONLY the summary.
+`
+
+const PlanTemplate = `
+Before doing anything, write a plan of the tool calls needed to fulfil the request below. The user will review the plan, and the steps will be executed in order once it is approved.
+
+IMPORTANT:
+1. Only use the tools listed below, and give every step a complete JSON input
+2. Do NOT add HumanTool steps: the user approves the whole plan before it runs
+3. Use explicit resource names so later steps can refer to resources created by earlier ones
+4. If the request can be answered without changing or reading the cluster, return no steps and put your response in "answer"
+
+TOOLS:
+------
+
+%s
+
+Reply with ONLY a JSON object in the following format:
+
+{"steps": [{"tool": "one of %s", "input": {"key": "value"}, "description": "what this step does"}], "answer": ""}
+
+New input: %s
+
+`
+
+const PlanResultTemplate = `
+The approved plan was executed with the following results:
+
+%s
+
+Based on these results, give the user a short answer describing what was done and anything that failed. Reply with the answer only.
+`
+
+const PlanCorrectionTemplate = `
+Your previous plan could not be processed: %s.
+
+Please reply again with ONLY a JSON object in the following format, using only the tools %s:
+
+{"steps": [{"tool": "ToolName", "input": {"key": "value"}, "description": "what this step does"}], "answer": ""}
+`
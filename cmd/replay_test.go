@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"kgent/cmd/ai"
+	"kgent/cmd/config"
+	"kgent/cmd/session"
+)
+
+// TestReplayChatTurn replays a recorded chat turn in which the model lists the pods of a
+// namespace through the Kgent API. No request leaves the machine: the hosts below do not
+// exist, the responses come from the cassette.
+func TestReplayChatTurn(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("KGENT_CASSETTE", "testdata/chat_turn.cassette.json")
+	t.Setenv("KGENT_CASSETTE_MODE", "replay")
+
+	config.Active = config.Config{
+		Backend:        config.BackendHTTP,
+		BackendURL:     "http://kgent-api.invalid/api/v1/resources",
+		MaxLoops:       config.DefaultMaxLoops,
+		ModelTimeout:   config.DefaultModelTimeout,
+		BackendTimeout: config.DefaultBackendTimeout,
+	}
+	providerCfg := ai.ProviderConfig{Type: ai.ProviderOpenAI, APIKey: "replay", BaseURL: "http://model-api.invalid/v1", Model: "mock"}
+	provider, err := ai.NewProvider(providerCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ai.ConfigureModels(provider, providerCfg, ai.ModelsConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	ai.MessageStore.Clear()
+
+	a := newAgent(chatCmd, newChatRegistry(false))
+	a.session = session.New("chat", "", ai.ModelName)
+	a.quiet = true
+	a.stream = false
+	a.toolCalling = false
+
+	done := make(chan *session.Turn, 1)
+	go func() { done <- a.runTurn("list the pods in namespace default") }()
+	var turn *session.Turn
+	select {
+	case turn = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the turn did not finish")
+	}
+
+	if turn.Error != "" {
+		t.Fatalf("turn failed: %s", turn.Error)
+	}
+	if turn.Answer != "The default namespace has one pod: web." {
+		t.Errorf("Answer = %q", turn.Answer)
+	}
+	if len(turn.ToolCalls) != 1 {
+		t.Fatalf("ToolCalls = %+v, want one ListTool call", turn.ToolCalls)
+	}
+	call := turn.ToolCalls[0]
+	if call.Name != "ListTool" || !strings.Contains(call.Output, "web") {
+		t.Errorf("ToolCalls[0] = %+v, want ListTool listing web", call)
+	}
+}
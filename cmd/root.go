@@ -24,6 +24,10 @@ package cmd
 import (
 	"os"
 
+	"kgent/cmd/ai"
+	"kgent/cmd/config"
+	"kgent/cmd/utils"
+
 	"github.com/spf13/cobra"
 )
 
@@ -40,6 +44,35 @@ cluster, and it will help you accomplish your tasks.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+	},
+}
+
+// loadConfig resolves the configuration of the selected profile and applies it. It does not
+// reach the network, the commands that need the model or the Kgent API check them themselves.
+func loadConfig(cmd *cobra.Command) {
+	profile, _ := cmd.Flags().GetString("profile")
+	cfg, err := config.Load(profile)
+	if err != nil {
+		utils.PrintRed("Error: %v", err)
+		os.Exit(1)
+	}
+	if cmd.Flags().Changed("context") {
+		cfg.KubeContext, _ = cmd.Flags().GetString("context")
+	}
+	if cmd.Flags().Changed("kubeconfig") {
+		cfg.Kubeconfig, _ = cmd.Flags().GetString("kubeconfig")
+	}
+	if cmd.Flags().Changed("backend") {
+		cfg.Backend, _ = cmd.Flags().GetString("backend")
+		if err := config.CheckBackend(cfg.Backend); err != nil {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+	config.Active = cfg
+	ai.RequestTimeout = cfg.ModelTimeout
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -56,7 +89,10 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.K8sGpt.yaml)")
+	rootCmd.PersistentFlags().String("context", "", "Kubeconfig context of the cluster to work on (default: the current context)")
+	rootCmd.PersistentFlags().String("kubeconfig", "", "Kubeconfig file used by kubectl and helm")
+	rootCmd.PersistentFlags().String("profile", "", "Profile of the config file to use (default: $KGENT_PROFILE or default_profile of ~/.config/kgent/config.yaml)")
+	rootCmd.PersistentFlags().String("backend", config.BackendHTTP, "Backend of the resource tools of chat: http for the Kgent API, direct for the Kubernetes API of the kubeconfig (default: $KGENT_BACKEND or http)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"kgent/cmd/backend"
+	"kgent/cmd/config"
+	"kgent/cmd/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// serveBackendCmd serves the Kgent API on the clusters of the kubeconfig
+var serveBackendCmd = &cobra.Command{
+	Use:   "serve-backend",
+	Short: "Serve the Kgent API on the clusters of the kubeconfig",
+	Long: `Serve the Kgent API used by the resource tools of chat, so no separate service is
+needed. Point KGENT_API_URL at the printed URL.
+
+  GET    /api/v1/resources/{resource}?ns=           lists the names of the resources
+  GET    /api/v1/resources/{resource}/{name}?ns=&format=yaml|json
+                                                    returns a resource
+  GET    /api/v1/resources/{resource}/{name}/describe?ns=
+                                                    returns a resource with its conditions,
+                                                    owners and recent events
+  POST   /api/v1/resources/{resource}               creates the resources of {"yaml": "..."}
+  DELETE /api/v1/resources/{resource}?ns=&name=     deletes a resource
+  GET    /health
+
+The cluster parameter of a request selects the kubeconfig context, --context is used
+without it. Only --context and the contexts of --allowed-contexts are served, other
+clusters are answered with 403. Resources are changed with the credentials of the
+kubeconfig.
+
+When KGENT_SERVE_TOKEN is set, requests to the resources endpoint must send it as a
+bearer token and are answered with 401 otherwise. --tls-cert and --tls-key serve HTTPS,
+--client-ca also requires a client certificate signed by one of its CAs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		tlsCert, _ := cmd.Flags().GetString("tls-cert")
+		tlsKey, _ := cmd.Flags().GetString("tls-key")
+		clientCA, _ := cmd.Flags().GetString("client-ca")
+		if (tlsCert == "") != (tlsKey == "") || (clientCA != "" && tlsCert == "") {
+			utils.PrintRed("Error: --tls-cert and --tls-key must be set together, and --client-ca needs them")
+			os.Exit(1)
+		}
+
+		allowedContexts, _ := cmd.Flags().GetStringSlice("allowed-contexts")
+		handler, err := backend.NewKubeconfigServer(config.Active.Kubeconfig, config.Active.KubeContext, allowedContexts)
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+		handler.Token = utils.GetEnv("KGENT_SERVE_TOKEN", "")
+		if !quiet {
+			handler.Logf = func(format string, args ...interface{}) {
+				utils.PrintCyan(format, args...)
+			}
+		}
+
+		server := &http.Server{Addr: addr, Handler: handler}
+		if clientCA != "" {
+			pool, err := loadCertPool(clientCA)
+			if err != nil {
+				utils.PrintRed("Error: %v", err)
+				os.Exit(1)
+			}
+			server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		scheme := "http"
+		if tlsCert != "" {
+			scheme = "https"
+		}
+		if handler.Token == "" && !isLoopback(addr) {
+			utils.PrintYellow("Warning: KGENT_SERVE_TOKEN is not set, anyone who can reach %s can change the cluster.", addr)
+		}
+		utils.PrintGreen("Kgent API listening, use KGENT_API_URL=%s://%s/api/v1/resources", scheme, addr)
+
+		if tlsCert != "" {
+			err = server.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.PrintRed("Error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// loadCertPool reads a PEM bundle of CAs
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func init() {
+	rootCmd.AddCommand(serveBackendCmd)
+
+	serveBackendCmd.Flags().String("addr", "127.0.0.1:8000", "Address to listen on")
+	serveBackendCmd.Flags().BoolP("quiet", "q", false, "Do not log the requests")
+	serveBackendCmd.Flags().String("tls-cert", "", "PEM certificate to serve HTTPS with")
+	serveBackendCmd.Flags().String("tls-key", "", "PEM key of --tls-cert")
+	serveBackendCmd.Flags().String("client-ca", "", "PEM bundle of the CAs of the client certificates to require")
+	serveBackendCmd.Flags().StringSlice("allowed-contexts", nil, "Other kubeconfig contexts that requests may select with the cluster parameter")
+}
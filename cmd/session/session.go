@@ -0,0 +1,203 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kgent/cmd/ai"
+)
+
+// ErrNotFound is returned when no stored session matches the requested ID
+var ErrNotFound = errors.New("session not found")
+
+// Session is a conversation with the assistant that can be saved and resumed later
+type Session struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	Namespace string `json:"namespace"`
+	// Context is the kubeconfig context the session works on, empty for the current context
+	Context   string          `json:"context,omitempty"`
+	Model     string          `json:"model"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Messages  ai.ChatMessages `json:"messages"`
+	Turns     []Turn          `json:"turns"`
+	// Usage is the token usage of all turns, including those before the session was resumed
+	Usage ai.Usage `json:"usage"`
+}
+
+// Turn records what happened while answering a single user input
+type Turn struct {
+	Query     string     `json:"query"`
+	Answer    string     `json:"answer"`
+	ToolCalls []ToolCall `json:"toolCalls"`
+	// Error describes why the turn ended without an answer
+	Error string `json:"error,omitempty"`
+	// Usage is the token usage of every AI call made for the turn
+	Usage ai.Usage `json:"usage"`
+}
+
+// ToolCall records a tool invocation made during a turn
+type ToolCall struct {
+	Name   string `json:"name"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// New creates an unsaved session for the given command
+func New(command string, namespace string, model string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:        newID(now),
+		Command:   command,
+		Namespace: namespace,
+		Model:     model,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// newID builds a sortable, human readable session ID
+func newID(now time.Time) string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return now.Format("20060102-150405")
+	}
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Dir returns the directory sessions are stored in
+func Dir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "kgent", "sessions"), nil
+}
+
+// path returns the file a session is stored in
+func path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// Save writes the session to the store
+func Save(s *Session) error {
+	file, err := path(s.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted save never corrupts the session
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return os.Rename(tmp, file)
+}
+
+// Load reads the session with the given ID from the store
+func Load(id string) (*Session, error) {
+	file, err := path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+// List returns all stored sessions, most recently updated first
+func List() ([]*Session, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		s, err := Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			// An unreadable or partially written session must not hide the others
+			fmt.Fprintf(os.Stderr, "Warning: skipping session %s: %v\n", entry.Name(), err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// Delete removes the session with the given ID from the store
+func Delete(id string) error {
+	file, err := path(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return err
+}
+
+// Title returns a short description of the session based on its first request
+func (s *Session) Title() string {
+	if len(s.Turns) == 0 {
+		return "(empty)"
+	}
+	title := strings.Join(strings.Fields(s.Turns[0].Query), " ")
+	if len([]rune(title)) > 60 {
+		title = string([]rune(title)[:57]) + "..."
+	}
+	return title
+}
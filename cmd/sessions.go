@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"kgent/cmd/session"
+	"kgent/cmd/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage saved conversations",
+	Long: `Every chat and check conversation is saved as a session under the user's
+config directory. Use the subcommands to list, inspect, resume or delete them.`,
+}
+
+// sessionsListCmd lists the saved sessions
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := session.List()
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			return
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No saved sessions.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCOMMAND\tNAMESPACE\tREQUESTS\tUPDATED\tTITLE")
+		for _, s := range sessions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", s.ID, s.Command, s.Namespace,
+				len(s.Turns), s.UpdatedAt.Format("2006-01-02 15:04"), s.Title())
+		}
+		w.Flush()
+	},
+}
+
+// sessionsShowCmd prints the requests, tool calls and answers of a session
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the requests, tool calls and answers of a session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := session.Load(args[0])
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			return
+		}
+
+		fmt.Printf("Session:   %s\n", s.ID)
+		fmt.Printf("Command:   kgent %s\n", s.Command)
+		fmt.Printf("Namespace: %s\n", s.Namespace)
+		if s.Context != "" {
+			fmt.Printf("Context:   %s\n", s.Context)
+		}
+		fmt.Printf("Model:     %s\n", s.Model)
+		fmt.Printf("Created:   %s\n", s.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Updated:   %s\n", s.UpdatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Usage:     %s\n", s.Usage)
+
+		for i, t := range s.Turns {
+			fmt.Println()
+			utils.PrintYellow("[%d] > %s", i+1, t.Query)
+			for _, call := range t.ToolCalls {
+				fmt.Printf("    %s %s\n", call.Name, call.Input)
+			}
+			utils.PrintCyan("%s", t.Answer)
+		}
+	},
+}
+
+// sessionsResumeCmd continues a saved session
+var sessionsResumeCmd = &cobra.Command{
+	Use:   "resume <id>",
+	Short: "Continue a saved session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := session.Load(args[0])
+		if err != nil {
+			utils.PrintRed("Error: %v", err)
+			return
+		}
+		setupAgent()
+		startSession(cmd, s)
+	},
+}
+
+// sessionsDeleteCmd removes saved sessions
+var sessionsDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete saved sessions",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, id := range args {
+			if err := session.Delete(id); err != nil {
+				utils.PrintRed("Error: %v", err)
+				continue
+			}
+			utils.PrintGreen("Deleted session %s", id)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd, sessionsResumeCmd, sessionsDeleteCmd)
+
+	// Resuming runs the agent loop, so it accepts the same flags as chat and check
+	addAgentFlags(sessionsResumeCmd)
+	sessionsResumeCmd.Flags().MarkHidden("resume")
+	sessionsResumeCmd.Flags().Bool("plan", false, "Review a plan of all tool calls before anything is executed (chat sessions only)")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"kgent/cmd/parser"
+	"kgent/cmd/utils"
+)
+
+// streamPrinter renders streamed ReAct output on the terminal as it arrives: only the text
+// following "Final Answer:" is printed
+type streamPrinter struct {
+	debugMode bool
+
+	content   strings.Builder
+	printed   int
+	answering bool
+	// skipSpace drops the whitespace between "Final Answer:" and the answer
+	skipSpace bool
+}
+
+// newStreamPrinter creates a printer for a single streamed response
+func newStreamPrinter(debugMode bool) *streamPrinter {
+	return &streamPrinter{
+		debugMode: debugMode,
+	}
+}
+
+// onDelta receives a content fragment and reports whether the stream should continue.
+// The stream is stopped as soon as a complete action is received, so the loop can run the
+// tool right away instead of waiting for the model to make up an observation.
+func (p *streamPrinter) onDelta(delta string) bool {
+	if p.content.Len() == 0 && p.debugMode {
+		fmt.Println("# Response from LLM:")
+	}
+	p.content.WriteString(delta)
+	text := p.content.String()
+
+	// An answer written after an action is made up and will not be shown
+	if idx := strings.Index(text, "Final Answer:"); !p.answering && idx >= 0 && !strings.Contains(text[:idx], "Action:") {
+		p.answering = true
+		p.skipSpace = true
+		p.printed = idx + len("Final Answer:")
+	}
+
+	if p.debugMode {
+		fmt.Print(delta)
+	} else if p.answering {
+		chunk := text[p.printed:]
+		if p.skipSpace {
+			chunk = strings.TrimLeft(chunk, " \t")
+			p.skipSpace = chunk == ""
+		}
+		if chunk != "" {
+			utils.PrintCyanNoNewline("%s", chunk)
+		}
+		p.printed = len(text)
+	}
+
+	if p.answering {
+		return true
+	}
+	return !parser.HasCompleteAction(text)
+}
+
+// finish terminates the line of streamed output
+func (p *streamPrinter) finish() {
+	if p.debugMode {
+		if p.content.Len() > 0 {
+			fmt.Println()
+			fmt.Println()
+		}
+	} else if p.answering {
+		fmt.Println()
+	}
+}
+
+// answered reports whether the answer has already been shown to the user
+func (p *streamPrinter) answered() bool {
+	return p.answering
+}
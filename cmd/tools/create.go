@@ -1,97 +1,91 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"kgent/cmd/ai"
+	"kgent/cmd/backend"
 	promptTpl "kgent/cmd/prompt"
-	"kgent/cmd/utils"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 type CreateToolParam struct {
-	Prompt   string `json:"prompt"`
-	Resource string `json:"resource"`
-}
-
-// define struct to parse JSON response
-type response struct {
-	Data  string `json:"data"`
-	Error string `json:"error"`
+	Prompt    string `json:"prompt"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace"`
 }
 
 // CreateTool represents a tool that creates a specified Kubernetes resource in a specified namespace.
 type CreateTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
+	debugMode bool
 }
 
 // NewCreateTool creates a new CreateTool instance.
-func NewCreateTool() *CreateTool {
+func NewCreateTool(debugMode bool) *CreateTool {
 	return &CreateTool{
-		Name:        "CreateTool",
-		Description: "Used to create a specified Kubernetes resource in a specified namespace, such as creating a pod etc.",
-		ArgsSchema:  `{"type":"object","properties":{"prompt":{"type":"string", "description": "Put the user's prompt for creating a resource exactly here, without any changes"},"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}}}`,
+		baseTool: baseTool{
+			name:        "CreateTool",
+			description: "Used to create a specified Kubernetes resource in a specified namespace, such as creating a pod etc.",
+			argsSchema:  `{"type":"object","properties":{"prompt":{"type":"string", "description": "Put the user's prompt for creating a resource exactly here, without any changes"},"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "namespace":{"type":"string", "description": "The namespace to create the resource in, if the prompt does not give one in the definition"}}}`,
+			risk:        RiskChange,
+		},
+		debugMode: debugMode,
 	}
 }
 
 // Run executes the command and returns the output.
-func (c *CreateTool) Run(prompt string, resource string, debugMode bool) string {
+func (c *CreateTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param CreateToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := c.create(ctx, param.Prompt, param.Resource, param.Namespace)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: output}, nil
+}
+
+// create generates the YAML for the resource and submits it to the backend.
+func (c *CreateTool) create(ctx context.Context, prompt string, resource string, namespace string) (string, error) {
 	// let the large model generate yaml
 	messages := make([]openai.ChatCompletionMessage, 2)
 
 	messages[0] = openai.ChatCompletionMessage{Role: "system", Content: promptTpl.K8sAssistantPrompt}
 	messages[1] = openai.ChatCompletionMessage{Role: "user", Content: prompt}
 
-	rsp := ai.Chat(messages)
+	// stream the response so that long YAML generations are not cut off by a timeout
+	rsp, err := ai.ChatStream(ctx, ai.ModelYAMLGeneration, messages, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
 
 	// remove ```yaml and ``` from the response
 	rsp.Content = strings.Replace(rsp.Content, "```yaml", "", -1)
 	rsp.Content = strings.Replace(rsp.Content, "```", "", -1)
 	rsp.Content = strings.TrimSpace(rsp.Content)
 
-	// create JSON object {"yaml":"xxx"}
-	body := map[string]string{"yaml": rsp.Content}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return err.Error()
-	}
-
-	// Get the API URL from environment variable with fallback
-	apiURL := utils.GetEnv("KGENT_API_URL", "http://localhost:8000/api/v1/resources")
-
-	// Ensure URL ends with a slash
-	if !strings.HasSuffix(apiURL, "/") {
-		apiURL += "/"
-	}
-
-	url := apiURL + resource
-	s, err := utils.PostHTTP(url, jsonBody)
-	if err != nil {
-		return err.Error()
+	if c.debugMode {
+		fmt.Println(rsp.Content)
 	}
 
-	var response response
-	// parse JSON response
-	err = json.Unmarshal([]byte(s), &response)
+	resources, err := backend.ResourcesFromConfig()
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
-
-	if debugMode {
-		fmt.Println(rsp.Content)
-		fmt.Println("[CreateTool] jsonBody", string(jsonBody))
-		fmt.Println("[CreateTool] url", url)
-		fmt.Println("[CreateTool] response", response)
+	data, err := resources.Create(ctx, resource, namespace, rsp.Content)
+	if c.debugMode {
+		fmt.Println("[CreateTool] resource", resource)
+		fmt.Println("[CreateTool] response", data, err)
 	}
-	// return error if response.Data is empty
-	if response.Data == "" {
-		return response.Error
+	if err != nil {
+		return "", err
 	}
-
-	return response.Data
+	return data, nil
 }
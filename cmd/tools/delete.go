@@ -1,9 +1,10 @@
 package tools
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
 
-	"kgent/cmd/utils"
+	"kgent/cmd/backend"
 )
 
 type DeleteToolParam struct {
@@ -14,35 +15,40 @@ type DeleteToolParam struct {
 
 // DeleteTool represents a tool that deletes a specified Kubernetes resource in a specified namespace.
 type DeleteTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
 }
 
 // NewDeleteTool creates a new DeleteTool instance.
 func NewDeleteTool() *DeleteTool {
 	return &DeleteTool{
-		Name:        "DeleteTool",
-		Description: "Used to delete a specified Kubernetes resource in a specified namespace, such as deleting a pod etc.",
-		ArgsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "name":{"type":"string", "description": "The name of the specified Kubernetes resource instance"}, "namespace":{"type":"string", "description": "The namespace of the specified Kubernetes resource"}}`,
+		baseTool: baseTool{
+			name:        "DeleteTool",
+			description: "Used to delete a specified Kubernetes resource in a specified namespace, such as deleting a pod etc.",
+			argsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "name":{"type":"string", "description": "The name of the specified Kubernetes resource instance"}, "namespace":{"type":"string", "description": "The namespace of the specified Kubernetes resource"}}}`,
+			risk:        RiskDestructive,
+		},
 	}
 }
 
 // Run executes the command and returns the output.
-func (d *DeleteTool) Run(resource, name, ns string) error {
-	resource = strings.ToLower(resource)
-
-	// Get the API URL from environment variable with fallback
-	apiURL := utils.GetEnv("KGENT_API_URL", "http://localhost:8000/api/v1/resources")
-
-	// Ensure URL ends with a slash
-	if !strings.HasSuffix(apiURL, "/") {
-		apiURL += "/"
+func (d *DeleteTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param DeleteToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
 	}
 
-	url := apiURL + resource + "?ns=" + ns + "&name=" + name
-
-	_, err := utils.DeleteHTTP(url)
+	if err := d.delete(ctx, param.Resource, param.Name, param.Namespace); err != nil {
+		return Result{}, err
+	}
+	return Result{Output: "Resource deleted successfully"}, nil
+}
 
+// delete removes the resource through the backend.
+func (d *DeleteTool) delete(ctx context.Context, resource, name, ns string) error {
+	resources, err := backend.ResourcesFromConfig()
+	if err != nil {
+		return err
+	}
+	_, err = resources.Delete(ctx, resource, ns, name)
 	return err
 }
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"kgent/cmd/backend"
+)
+
+type DescribeToolParam struct {
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// DescribeTool represents a tool that describes a single Kubernetes resource with its
+// conditions, owners and recent events.
+type DescribeTool struct {
+	baseTool
+}
+
+// NewDescribeTool creates a new DescribeTool instance.
+func NewDescribeTool() *DescribeTool {
+	return &DescribeTool{
+		baseTool: baseTool{
+			name:        "DescribeTool",
+			description: "Used to find out why a single Kubernetes resource is not working, such as a pod that is not ready. Returns the resource with its conditions, the chain of its owners and its recent events.",
+			argsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "name":{"type":"string", "description": "The name of the resource"}, "namespace":{"type":"string", "description": "The specified Kubernetes namespace"}}}`,
+		},
+	}
+}
+
+// Run executes the command and returns the output.
+func (d *DescribeTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param DescribeToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := d.describe(ctx, param.Resource, param.Name, param.Namespace)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: output}, nil
+}
+
+// describe fetches the description of the resource from the backend, which looks it up in the
+// default namespace without one.
+func (d *DescribeTool) describe(ctx context.Context, resource string, name string, ns string) (string, error) {
+	resources, err := backend.ResourcesFromConfig()
+	if err != nil {
+		return "", err
+	}
+	return resources.Describe(ctx, resource, ns, name)
+}
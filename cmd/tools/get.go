@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+
+	"kgent/cmd/backend"
+)
+
+type GetToolParam struct {
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Format    string `json:"format"`
+}
+
+// GetTool represents a tool that fetches the full definition of a single Kubernetes resource.
+type GetTool struct {
+	baseTool
+}
+
+// NewGetTool creates a new GetTool instance.
+func NewGetTool() *GetTool {
+	return &GetTool{
+		baseTool: baseTool{
+			name:        "GetTool",
+			description: "Used to get the full spec and status of a single Kubernetes resource by name, such as a pod or a deployment.",
+			argsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "name":{"type":"string", "description": "The name of the resource"}, "namespace":{"type":"string", "description": "The specified Kubernetes namespace"}, "format":{"type":"string", "description": "The output format, yaml or json, yaml by default"}}}`,
+		},
+	}
+}
+
+// Run executes the command and returns the output.
+func (g *GetTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param GetToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := g.get(ctx, param.Resource, param.Name, param.Namespace, param.Format)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: output}, nil
+}
+
+// get fetches the resource from the backend, which looks it up in the default namespace without one.
+func (g *GetTool) get(ctx context.Context, resource string, name string, ns string, format string) (string, error) {
+	resources, err := backend.ResourcesFromConfig()
+	if err != nil {
+		return "", err
+	}
+	return resources.Get(ctx, resource, ns, name, format)
+}
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+
+	"kgent/cmd/cassette"
 )
 
 // RequestsToolParam represents the input for the RequestsTool
@@ -19,28 +22,43 @@ type RequestsToolParam struct {
 // RequestsTool provides functionality to make HTTP requests and process the responses.
 // It extracts text content from HTML responses.
 type RequestsTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
-	client      *http.Client
+	baseTool
+	client *http.Client
 }
 
 // NewRequestsTool creates and returns a new RequestsTool with default configuration.
 func NewRequestsTool() *RequestsTool {
 	return &RequestsTool{
-		Name:        "RequestsTool",
-		Description: `A portal to the internet. Use this when you need to get specific content from a website. Input should be a url (i.e. https://www.kubernetes.io/releases). The output will be the text response of the GET request.`,
-		ArgsSchema:  `{"type":"object","properties":{"url":{"type":"string", "description": "the url to be accessed, e.g. https://www.kubernetes.io/releases"}}}`,
+		baseTool: baseTool{
+			name:        "RequestsTool",
+			description: `A portal to the internet. Use this when you need to get specific content from a website. Input should be a url (i.e. https://www.kubernetes.io/releases). The output will be the text response of the GET request.`,
+			argsSchema:  `{"type":"object","properties":{"url":{"type":"string", "description": "the url to be accessed, e.g. https://www.kubernetes.io/releases"}}}`,
+		},
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: cassette.Transport(http.DefaultTransport),
 		},
 	}
 }
 
-// Run makes a GET request to the specified URL and returns the text content.
+// Run makes a GET request to the URL in the action input and returns the text content.
+func (r *RequestsTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param RequestsToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := r.get(ctx, param.Url)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: fmt.Sprintf("Request results: %v", output)}, nil
+}
+
+// get makes a GET request to the specified URL and returns the text content.
 // It uses context with timeout for proper cancellation support.
-func (r *RequestsTool) Run(url string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (r *RequestsTool) get(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -91,8 +109,8 @@ func (r *RequestsTool) parseHTML(htmlContent string) (string, error) {
 
 // RunWithHeaders makes a GET request with custom headers to the specified URL.
 // This is a more flexible version of Run that allows setting HTTP headers.
-func (r *RequestsTool) RunWithHeaders(url string, headers map[string]string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (r *RequestsTool) RunWithHeaders(ctx context.Context, url string, headers map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -1,9 +1,9 @@
 package tools
 
 import (
-	"fmt"
-
-	"kgent/cmd/utils"
+	"context"
+	"encoding/json"
+	"strings"
 )
 
 type HumanToolParam struct {
@@ -12,25 +12,46 @@ type HumanToolParam struct {
 
 // HumanTool represents a tool that asks for human confirmation before performing dangerous operations.
 type HumanTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
+	// Ask prompts the user and returns the answer. Without it, as in one-shot mode where no one
+	// can answer, every confirmation is declined.
+	Ask func(ctx context.Context, prompt string) (string, error)
 }
 
 // NewHumanTool creates a new HumanTool instance.
 func NewHumanTool() *HumanTool {
 	return &HumanTool{
-		Name:        "HumanTool",
-		Description: "When you determine that you need to perform dangerous operations, such as deletion, you need to use this tool to initiate a confirmation request to humans first.",
-		ArgsSchema:  `{"type":"object","properties":{"prompt":{"type":"string", "description": "The action you want to perform, such as deleting a pod", "example": "Please confirm whether to delete the foo-app pod in the default namespace"}}}`,
+		baseTool: baseTool{
+			name:        "HumanTool",
+			description: "When you determine that you need to perform dangerous operations, such as deletion, you need to use this tool to initiate a confirmation request to humans first.",
+			argsSchema:  `{"type":"object","properties":{"prompt":{"type":"string", "description": "The action you want to perform, such as deleting a pod", "example": "Please confirm whether to delete the foo-app pod in the default namespace"}}}`,
+		},
 	}
 }
 
 // Run executes the command and returns the output.
-func (h *HumanTool) Run(prompt string) string {
-	utils.PrintYellowNoNewline(prompt + " (yes/no): ")
-	var input string
-	fmt.Scanln(&input)
+func (h *HumanTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param HumanToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+	if h.Ask == nil {
+		return Result{Output: "No human is available to confirm, the operation is declined. Do I need to use a tool? No"}, nil
+	}
+	answer, err := h.Ask(ctx, param.Prompt+" (yes/no): ")
+	if err != nil {
+		return Result{}, err
+	}
+	// The turn may have been interrupted while waiting for the answer
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	return Result{Output: translateAnswer(answer)}, nil
+}
+
+// translateAnswer translates the answer of the user for the model.
+func translateAnswer(input string) string {
+	input = strings.TrimSpace(input)
 
 	// Provide more context in the response
 	if input == "y" || input == "yes" {
@@ -1,9 +1,15 @@
 package tools
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
+
+	"kgent/cmd/config"
 )
 
 // KubeInput represents the input for the KubeTool.
@@ -13,39 +19,126 @@ type KubeInput struct {
 
 // KubeTool represents a tool that runs Kubernetes commands.
 type KubeTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
 }
 
 // NewKubeTool creates a new KubeTool instance.
 func NewKubeTool() *KubeTool {
 	return &KubeTool{
-		Name:        "KubeTool",
-		Description: "A tool for running Kubernetes commands (kubectl, helm) on a Kubernetes cluster.",
-		ArgsSchema:  `{"type":"object","properties":{"commands":{"type":"string", "description": "The kubectl/helm related command to run. e.g. kubectl get pods"}}}`,
+		baseTool: baseTool{
+			name:        "KubeTool",
+			description: "A tool for running Kubernetes commands (kubectl, helm) on a Kubernetes cluster.",
+			argsSchema:  `{"type":"object","properties":{"commands":{"type":"string", "description": "The kubectl/helm related command to run. e.g. kubectl get pods"}}}`,
+			// Arbitrary kubectl and helm commands may delete resources
+			risk: RiskDestructive,
+		},
 	}
 }
 
 // Run executes the command and returns the output.
-func (k *KubeTool) Run(commands string) (string, error) {
+func (k *KubeTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param KubeInput
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := k.execute(ctx, param.Commands)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: output}, nil
+}
+
+// execute runs the kubectl/helm command line. The process is killed when ctx is cancelled.
+func (k *KubeTool) execute(ctx context.Context, commands string) (string, error) {
 	parsedCommands := k.parseCommands(commands)
 
 	splitedCommands := k.splitCommands(parsedCommands)
-	fmt.Println("splitedCommands", splitedCommands)
+	// The configured cluster goes first, so a context given in the command itself still wins
+	args := append(ClusterArgs(splitedCommands[0]), splitedCommands[1:]...)
 	// You usually use the os/exec package to execute the command and return the output.
-	cmd := exec.Command(splitedCommands[0], splitedCommands[1:]...)
+	cmd := exec.CommandContext(ctx, splitedCommands[0], args...)
 
 	// Run the command and get the output
 	output, err := cmd.Output()
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %s", strings.Join(splitedCommands, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
 		return "", err
 	}
 
 	return fmt.Sprintf("The result of the command execution: %s", output), nil
 }
 
+// ClusterArgs returns the flags that point kubectl or helm to the configured kubeconfig and
+// context. Other commands get no flags.
+func ClusterArgs(command string) []string {
+	var contextFlag string
+	switch filepath.Base(command) {
+	case "kubectl":
+		contextFlag = "--context"
+	case "helm":
+		contextFlag = "--kube-context"
+	default:
+		return nil
+	}
+
+	var args []string
+	if config.Active.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", config.Active.Kubeconfig)
+	}
+	if config.Active.KubeContext != "" {
+		args = append(args, contextFlag, config.Active.KubeContext)
+	}
+	return args
+}
+
+// CurrentContext returns the configured kubeconfig context, or the current context of the
+// kubeconfig if none is configured
+func CurrentContext(ctx context.Context) (string, error) {
+	if config.Active.KubeContext != "" {
+		return config.Active.KubeContext, nil
+	}
+	output, err := kubectl(ctx, "config", "current-context")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// CheckContext returns an error if the kubeconfig has no context of the given name
+func CheckContext(ctx context.Context, name string) error {
+	output, err := kubectl(ctx, "config", "get-contexts", "-o", "name")
+	if err != nil {
+		return err
+	}
+	for _, existing := range strings.Fields(output) {
+		if existing == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("the kubeconfig has no context %q", name)
+}
+
+// kubectl runs kubectl with the configured kubeconfig and returns its output
+func kubectl(ctx context.Context, args ...string) (string, error) {
+	var kubeconfigArgs []string
+	if config.Active.Kubeconfig != "" {
+		kubeconfigArgs = []string{"--kubeconfig", config.Active.Kubeconfig}
+	}
+	output, err := exec.CommandContext(ctx, "kubectl", append(kubeconfigArgs, args...)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("kubectl %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
 // parseCommands cleans the command string.
 func (k *KubeTool) parseCommands(commands string) string {
 	return strings.TrimSpace(strings.Trim(commands, "\"`"))
@@ -1,9 +1,10 @@
 package tools
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
 
-	"kgent/cmd/utils"
+	"kgent/cmd/backend"
 )
 
 type ListToolParam struct {
@@ -13,40 +14,44 @@ type ListToolParam struct {
 
 // ListTool represents a tool that lists Kubernetes resources in a specified namespace.
 type ListTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
 }
 
 // NewListTool creates a new ListTool instance.
 func NewListTool() *ListTool {
 	return &ListTool{
-		Name:        "ListTool",
-		Description: "Used to list the specified Kubernetes resources in a specified namespace, such as pod list etc.",
-		ArgsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "namespace":{"type":"string", "description": "The specified Kubernetes namespace"}}`,
+		baseTool: baseTool{
+			name:        "ListTool",
+			description: "Used to list the specified Kubernetes resources in a specified namespace, such as pod list etc.",
+			argsSchema:  `{"type":"object","properties":{"resource":{"type":"string", "description": "The specified Kubernetes resource type, such as pod, service etc."}, "namespace":{"type":"string", "description": "The specified Kubernetes namespace"}}}`,
+		},
 	}
 }
 
 // Run executes the command and returns the output.
-func (l *ListTool) Run(resource string, ns string) (string, error) {
+func (l *ListTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param ListToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := l.list(ctx, param.Resource, param.Namespace)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: output}, nil
+}
+
+// list fetches the resources of the given type from the backend.
+func (l *ListTool) list(ctx context.Context, resource string, ns string) (string, error) {
 	// Set default namespace if not provided
 	if ns == "" {
 		ns = "default"
 	}
 
-	resource = strings.ToLower(resource)
-
-	// Get the API URL from environment variable with fallback
-	apiURL := utils.GetEnv("KGENT_API_URL", "http://localhost:8000/api/v1/resources")
-
-	// Ensure URL ends with a slash
-	if !strings.HasSuffix(apiURL, "/") {
-		apiURL += "/"
+	resources, err := backend.ResourcesFromConfig()
+	if err != nil {
+		return "", err
 	}
-
-	url := apiURL + resource + "?ns=" + ns
-
-	s, err := utils.GetHTTP(url)
-
-	return s, err
+	return resources.List(ctx, resource, ns)
 }
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Registry keeps the tools available to a command in registration order.
+type Registry struct {
+	tools  []Tool
+	byName map[string]Tool
+}
+
+// NewRegistry creates a registry containing the given tools.
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{
+		byName: make(map[string]Tool),
+	}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register adds a tool to the registry. Registering two tools with the same name is a programming error.
+func (r *Registry) Register(t Tool) {
+	if _, exists := r.byName[t.Name()]; exists {
+		panic(fmt.Sprintf("tools: tool %q registered twice", t.Name()))
+	}
+	r.tools = append(r.tools, t)
+	r.byName[t.Name()] = t
+}
+
+// Get returns the tool registered under name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// Tools returns all registered tools in registration order.
+func (r *Registry) Tools() []Tool {
+	return r.tools
+}
+
+// Names returns the names of all registered tools in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for _, t := range r.tools {
+		names = append(names, t.Name())
+	}
+	return names
+}
+
+// OpenAITools converts the registered tools into function definitions for native tool calling.
+func (r *Registry) OpenAITools() ([]openai.Tool, error) {
+	defs := make([]openai.Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		if !json.Valid([]byte(t.ArgsSchema())) {
+			return nil, fmt.Errorf("tool %s has an invalid ArgsSchema", t.Name())
+		}
+		defs = append(defs, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  json.RawMessage(t.ArgsSchema()),
+			},
+		})
+	}
+	return defs, nil
+}
+
+// Run looks up the named tool and executes it with the given input.
+func (r *Registry) Run(ctx context.Context, name string, input json.RawMessage) (Result, error) {
+	t, ok := r.Get(name)
+	if !ok {
+		return Result{}, fmt.Errorf("unknown tool: %s", name)
+	}
+	return t.Run(ctx, input)
+}
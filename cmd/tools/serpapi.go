@@ -1,11 +1,16 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	g "github.com/serpapi/google-search-results-golang"
+
+	"kgent/cmd/cassette"
 )
 
 // SerpApiToolParam represents the input for the SerpApiTool
@@ -15,9 +20,8 @@ type SerpApiToolParam struct {
 
 // SerpApiTool represents a tool for searching the web via SerpAPI
 type SerpApiTool struct {
-	Name        string
-	Description string
-	ArgsSchema  string
+	baseTool
+	client *http.Client
 }
 
 type FinalResult struct {
@@ -28,25 +32,25 @@ type FinalResult struct {
 // NewSerpApiTool creates a new instance of SerpApiTool
 func NewSerpApiTool() *SerpApiTool {
 	return &SerpApiTool{
-		Name:        "serpapi_search",
-		Description: "Search the web for information using DuckDuckGo search engine via SerpAPI",
-		ArgsSchema:  `{"type":"object","properties":{"query":{"type":"string", "description": "the search query to be used"}}}`,
+		baseTool: baseTool{
+			name:        "serpapi_search",
+			description: "Search the web for information using DuckDuckGo search engine via SerpAPI",
+			argsSchema:  `{"type":"object","properties":{"query":{"type":"string", "description": "the search query to be used"}}}`,
+		},
+		client: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: cassette.Transport(http.DefaultTransport),
+		},
 	}
 }
 
-// GetName returns the tool name
-func (t *SerpApiTool) GetName() string {
-	return t.Name
-}
-
-// GetDescription returns the tool description
-func (t *SerpApiTool) GetDescription() string {
-	return t.Description
-}
-
 // ToJSON converts the tool to JSON format
 func (t *SerpApiTool) ToJSON() (string, error) {
-	bytes, err := json.Marshal(t)
+	bytes, err := json.Marshal(map[string]string{
+		"name":        t.Name(),
+		"description": t.Description(),
+		"argsSchema":  t.ArgsSchema(),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -70,6 +74,7 @@ func (t *SerpApiTool) ExecuteSearch(query string, engine string) (map[string]int
 
 	// Create search client and execute search
 	search := g.NewGoogleSearch(parameter, apiKey)
+	search.HttpSearch = t.client
 	results, err := search.GetJSON()
 	if err != nil {
 		return nil, fmt.Errorf("SerpAPI search failed: %v", err)
@@ -79,7 +84,21 @@ func (t *SerpApiTool) ExecuteSearch(query string, engine string) (map[string]int
 }
 
 // Run executes the tool with the given arguments
-func (t *SerpApiTool) Run(query string) ([]FinalResult, error) {
+func (t *SerpApiTool) Run(ctx context.Context, input json.RawMessage) (Result, error) {
+	var param SerpApiToolParam
+	if err := decodeInput(input, &param); err != nil {
+		return Result{}, err
+	}
+
+	output, err := t.search(ctx, param.Query)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Output: fmt.Sprintf("Search results: %v, I need to use the tool httpRequest to get the content of the search results", output)}, nil
+}
+
+// search queries SerpAPI and keeps the title and link of every organic result
+func (t *SerpApiTool) search(ctx context.Context, query string) ([]FinalResult, error) {
 	// Extract search query from arguments
 	if query == "" {
 		return nil, fmt.Errorf("query parameter is required")
@@ -88,10 +107,27 @@ func (t *SerpApiTool) Run(query string) ([]FinalResult, error) {
 	// Get search engine (default to bing if not specified)
 	engine := "duckduckgo"
 
-	// Execute search
-	results, err := t.ExecuteSearch(query, engine)
-	if err != nil {
-		return nil, err
+	// Execute search. The SerpAPI client does not take a context, so stop waiting for it
+	// when ctx is cancelled.
+	type searchResult struct {
+		results map[string]interface{}
+		err     error
+	}
+	done := make(chan searchResult, 1)
+	go func() {
+		results, err := t.ExecuteSearch(query, engine)
+		done <- searchResult{results: results, err: err}
+	}()
+
+	var results map[string]interface{}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		results = r.results
 	}
 
 	// get all the title and link
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Tool is implemented by every action the assistant can take on behalf of the user.
+type Tool interface {
+	// Name is the identifier the model uses in "Action:".
+	Name() string
+	// Description tells the model when the tool should be used.
+	Description() string
+	// ArgsSchema is the JSON schema of the tool input.
+	ArgsSchema() string
+	// Risk is how much running the tool can change the cluster.
+	Risk() Risk
+	// Run executes the tool with the raw JSON input produced by the model.
+	Run(ctx context.Context, input json.RawMessage) (Result, error)
+}
+
+// Result represents the outcome of a tool invocation that is reported back to the model.
+type Result struct {
+	Output string
+}
+
+// Risk classifies the effect of a tool on the cluster
+type Risk int
+
+const (
+	// RiskReadOnly tools only read data
+	RiskReadOnly Risk = iota
+	// RiskChange tools create or modify resources
+	RiskChange
+	// RiskDestructive tools delete resources or may otherwise lose data
+	RiskDestructive
+)
+
+// String returns the marker shown next to planned steps
+func (r Risk) String() string {
+	switch r {
+	case RiskReadOnly:
+		return "read-only"
+	case RiskChange:
+		return "change"
+	case RiskDestructive:
+		return "destructive"
+	default:
+		return fmt.Sprintf("Risk(%d)", int(r))
+	}
+}
+
+// baseTool holds the metadata shared by all tools and implements the descriptive part of Tool.
+type baseTool struct {
+	name        string
+	description string
+	argsSchema  string
+	risk        Risk
+}
+
+// Name returns the tool name
+func (b baseTool) Name() string {
+	return b.name
+}
+
+// Description returns the tool description
+func (b baseTool) Description() string {
+	return b.description
+}
+
+// ArgsSchema returns the JSON schema of the tool input
+func (b baseTool) ArgsSchema() string {
+	return b.argsSchema
+}
+
+// Risk returns how much the tool can change the cluster
+func (b baseTool) Risk() Risk {
+	return b.risk
+}
+
+// decodeInput parses the raw action input into the tool specific parameter struct.
+func decodeInput(input json.RawMessage, param interface{}) error {
+	if err := json.Unmarshal(input, param); err != nil {
+		return fmt.Errorf("failed to parse action input: %w", err)
+	}
+	return nil
+}